@@ -0,0 +1,263 @@
+package lanchester
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// wilsonZ is the normal quantile of the 95% Wilson score intervals.
+const wilsonZ = 1.959963984540054
+
+// aggregateQuantiles are the quantiles written for survivors and turns,
+// besides the mean.
+var aggregateQuantiles = []struct {
+	name string
+	q    float64
+}{{"p05", 0.05}, {"p25", 0.25}, {"median", 0.5}, {"p75", 0.75}, {"p95", 0.95}}
+
+// Aggregator writes battle results as CSV, one row per design point
+// instead of one per run: the values of the fields over which the batch
+// ranges, the number of runs and the first of them, the proportion of
+// runs won by each side and ending with no force standing, each with a 95%
+// Wilson score interval, the proportions incomplete and stalled, and the
+// mean and quantiles of the survivors of each side and of the turns fought.
+//
+// Runs are grouped as they come, so memory does not grow with the batch:
+// a row is written as soon as a run with different parameters arrives.
+// Every batch mode runs all the battles of a design point one after
+// another; in the random modes a combination drawn twice by chance gets a
+// row each time.
+type Aggregator struct {
+	w      *csv.Writer
+	ranges []parameterRange
+	sides  []string
+
+	key   string
+	group *aggregate
+}
+
+// aggregate holds the running statistics of one design point.
+type aggregate struct {
+	fields   []string
+	runs     int
+	first    int
+	wins     []int
+	outcomes [Stalled + 1]int
+	// counts of each value of the survivors of every side, then the turns;
+	// both are whole numbers with few distinct values, so the quantiles
+	// are exact
+	counts []map[int]int
+	sums   []float64
+}
+
+// NewAggregator returns an Aggregator that writes to w the design points
+// of the batch the settings describe.
+func NewAggregator(w io.Writer, set *Settings) *Aggregator {
+	a := &Aggregator{w: csv.NewWriter(w), ranges: set.ranges()}
+	for _, side := range set.withForces(Parameters{}).AllSides() {
+		a.sides = append(a.sides, side.Name)
+	}
+	return a
+}
+
+// WriteHeader writes the column names.
+func (a *Aggregator) WriteHeader() error {
+	var headers []string
+	for _, r := range a.ranges {
+		headers = append(headers, kebab(r.name))
+	}
+	headers = append(headers, "runs", "first-run")
+	for _, side := range a.sides {
+		headers = append(headers, side+"-victory", side+"-victory-low", side+"-victory-high")
+	}
+	tie := Tie.String()
+	headers = append(headers, tie, tie+"-low", tie+"-high", Incomplete.String(), Stalled.String())
+	for _, name := range a.statistics() {
+		headers = append(headers, name+"-mean")
+		for _, q := range aggregateQuantiles {
+			headers = append(headers, name+"-"+q.name)
+		}
+	}
+	if err := a.w.Write(headers); err != nil {
+		return err
+	}
+	a.w.Flush()
+	return a.w.Error()
+}
+
+// statistics returns the names of the quantities summarised by their mean
+// and quantiles: the survivors of each side, then the turns fought.
+func (a *Aggregator) statistics() []string {
+	var names []string
+	for _, side := range a.sides {
+		names = append(names, side+"-forces")
+	}
+	return append(names, "turns")
+}
+
+// Add adds a completed run, first writing the row of the previous design
+// point if the run starts a new one. The run must be fought between the
+// sides of the settings the Aggregator was made for.
+func (a *Aggregator) Add(j Job) error {
+	if len(j.Result.Forces) != len(a.sides) {
+		return fmt.Errorf("run %v has %v sides, not %v", j.Num, len(j.Result.Forces), len(a.sides))
+	}
+	fields := make([]string, len(a.ranges))
+	p := reflect.ValueOf(j.Params)
+	for i, r := range a.ranges {
+		v := p.FieldByName(r.name)
+		if v.Kind() == reflect.Float64 {
+			fields[i] = formatFloat(v.Float())
+		} else {
+			fields[i] = fmt.Sprintf("%v", v.Interface())
+		}
+	}
+	key := strings.Join(fields, ",")
+	if a.group != nil && key != a.key {
+		if err := a.flush(); err != nil {
+			return err
+		}
+	}
+	if a.group == nil {
+		a.key = key
+		a.group = &aggregate{
+			fields: fields,
+			first:  j.Num,
+			wins:   make([]int, len(a.sides)),
+			counts: make([]map[int]int, len(a.sides)+1),
+			sums:   make([]float64, len(a.sides)+1),
+		}
+		for i := range a.group.counts {
+			a.group.counts[i] = make(map[int]int)
+		}
+	}
+	g, res := a.group, j.Result
+	g.runs++
+	if res.Outcome >= 0 && int(res.Outcome) < len(g.outcomes) {
+		g.outcomes[res.Outcome]++
+	}
+	for i, side := range a.sides {
+		if won(res, i, side) {
+			g.wins[i]++
+		}
+	}
+	for i, x := range append(append([]int(nil), res.Forces...), res.Turns) {
+		g.counts[i][x]++
+		g.sums[i] += float64(x)
+	}
+	return nil
+}
+
+// won reports whether the i-th side, of the given name, won the battle.
+func won(res Result, i int, name string) bool {
+	switch res.Outcome {
+	case RedVictory:
+		return i == 0
+	case BlueVictory:
+		return i == 1
+	case Victory:
+		for _, v := range res.Victors {
+			if v == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Close writes the row of the last design point.
+func (a *Aggregator) Close() error {
+	if a.group == nil {
+		return nil
+	}
+	return a.flush()
+}
+
+// flush writes the row of the current design point.
+func (a *Aggregator) flush() error {
+	g := a.group
+	a.group = nil
+	n := float64(g.runs)
+	s := append(g.fields, fmt.Sprintf("%v", g.runs), fmt.Sprintf("%v", g.first))
+	proportion := func(k int) []string {
+		low, high := wilson(k, g.runs)
+		return []string{formatFloat(float64(k) / n), formatFloat(low), formatFloat(high)}
+	}
+	for i := range a.sides {
+		s = append(s, proportion(g.wins[i])...)
+	}
+	s = append(s, proportion(g.outcomes[Tie])...)
+	s = append(s, formatFloat(float64(g.outcomes[Incomplete])/n), formatFloat(float64(g.outcomes[Stalled])/n))
+	for i := range g.counts {
+		s = append(s, formatFloat(g.sums[i]/n))
+		for _, q := range aggregateQuantiles {
+			s = append(s, formatFloat(histogramQuantile(g.counts[i], g.runs, q.q)))
+		}
+	}
+	if err := a.w.Write(s); err != nil {
+		return err
+	}
+	a.w.Flush()
+	return a.w.Error()
+}
+
+// wilson returns the 95% Wilson score interval of a proportion of k
+// successes in n trials.
+func wilson(k, n int) (low, high float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	p, z2 := float64(k)/float64(n), wilsonZ*wilsonZ
+	d := 1 + z2/float64(n)
+	centre := (p + z2/(2*float64(n))) / d
+	half := wilsonZ * math.Sqrt(p*(1-p)/float64(n)+z2/(4*float64(n)*float64(n))) / d
+	return math.Max(0, centre-half), math.Min(1, centre+half)
+}
+
+// histogramQuantile returns the q-quantile of n values given as counts of
+// each value, as quantile does for the sorted values.
+func histogramQuantile(counts map[int]int, n int, q float64) float64 {
+	values := make([]int, 0, len(counts))
+	for x := range counts {
+		values = append(values, x)
+	}
+	sort.Ints(values)
+	// the value of the k-th order statistic, counting from 0
+	at := func(k int) float64 {
+		for _, x := range values {
+			if k < counts[x] {
+				return float64(x)
+			}
+			k -= counts[x]
+		}
+		return float64(values[len(values)-1])
+	}
+	h := q * float64(n-1)
+	i := int(h)
+	if i >= n-1 {
+		return at(n - 1)
+	}
+	return at(i) + (h-float64(i))*(at(i+1)-at(i))
+}
+
+// kebab converts a Go field name such as RedShotProb to the column name
+// red-shot-prob.
+func kebab(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package lanchester
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestWilson(t *testing.T) {
+	for _, c := range []struct {
+		k, n      int
+		low, high float64
+	}{
+		{8, 10, 0.4902, 0.9433},
+		{0, 10, 0, 0.2775},
+		{10, 10, 0.7225, 1},
+		{50, 100, 0.4038, 0.5962},
+		{0, 0, 0, 1},
+	} {
+		low, high := wilson(c.k, c.n)
+		if math.Abs(low-c.low) > 5e-5 || math.Abs(high-c.high) > 5e-5 {
+			t.Errorf("%v of %v: interval [%.4f, %.4f], want [%v, %v]", c.k, c.n, low, high, c.low, c.high)
+		}
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 7, 100, 1001} {
+		counts := make(map[int]int)
+		values := make([]float64, n)
+		for i := range values {
+			x := rng.Intn(20)
+			counts[x]++
+			values[i] = float64(x)
+		}
+		sort.Float64s(values)
+		for _, q := range []float64{0, 0.05, 0.25, 0.5, 0.75, 0.95, 1} {
+			if got, want := histogramQuantile(counts, n, q), quantile(values, q); got != want {
+				t.Errorf("%v values: %v-quantile %v, want %v", n, q, got, want)
+			}
+		}
+	}
+}
+
+// TestAggregator checks that the replicates of every design point of a
+// sweep collapse to one row, and that the row agrees with the runs.
+func TestAggregator(t *testing.T) {
+	set := &Settings{
+		BatchMode:       ParameterSweep,
+		Niter:           25,
+		Seed:            3,
+		ActivationOrder: []ActivationOrder{RandomSynchronous, UniformAsynchronous},
+		RedSize:         [3]int{5, 10, 5},
+		RedHealth:       [3]int{1, 1, 0},
+		RedShotProb:     [3]float64{0.3, 0.3, 0},
+		RedMaxShots:     [3]int{2, 2, 0},
+		BlueSize:        [3]int{8, 8, 0},
+		BlueHealth:      [3]int{1, 1, 0},
+		BlueShotProb:    [3]float64{0.3, 0.3, 0},
+		BlueMaxShots:    [3]int{2, 2, 0},
+	}
+	var buf bytes.Buffer
+	agg := NewAggregator(&buf, set)
+	if err := agg.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	var redWins [4]int
+	err := set.Execute(func(j Job) error {
+		if j.Result.Outcome == RedVictory {
+			redWins[(j.Num-1)/set.Niter]++
+		}
+		return agg.Add(j)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 5 {
+		t.Fatalf("%v rows, want a header and 4 design points", len(rows))
+	}
+	col := make(map[string]int)
+	for i, h := range rows[0] {
+		col[h] = i
+	}
+	for i, row := range rows[1:] {
+		for name, want := range map[string]string{
+			"activation-order": []ActivationOrder{RandomSynchronous, RandomSynchronous, UniformAsynchronous, UniformAsynchronous}[i].String(),
+			"red-size":         []string{"5", "10", "5", "10"}[i],
+			"runs":             "25",
+			"first-run":        strconv.Itoa(25*i + 1),
+			"red-victory":      formatFloat(float64(redWins[i]) / 25),
+		} {
+			if got := row[col[name]]; got != want {
+				t.Errorf("row %v: %v is %v, want %v", i+1, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package lanchester
+
+import (
+	"fmt"
+	"math"
+)
+
+// Law selects one of the deterministic Lanchester attrition laws.
+type Law int
+
+const (
+	// Area fire: each side's losses are proportional to both force sizes
+	LinearLaw Law = iota
+	// Aimed fire: each side's losses are proportional to the enemy's size
+	SquareLaw
+	// Red is a guerrilla force under area fire; blue is under aimed fire
+	MixedRedGuerrillaLaw
+	// Blue is a guerrilla force under area fire; red is under aimed fire
+	MixedBlueGuerrillaLaw
+	// Helmbold's generalization, interpolating between the logarithmic
+	// (W = 0) and square (W = 1) laws
+	HelmboldLaw
+)
+
+const (
+	// integration step, in turns
+	analyticStep = 0.01
+	// give up on battles that have not ended after this many turns
+	analyticMaxTurns = 10000
+	// a force with less than half a unit left is annihilated
+	analyticMinForce = 0.5
+)
+
+func (l Law) String() string {
+	switch l {
+	case LinearLaw:
+		return "linear"
+	case SquareLaw:
+		return "square"
+	case MixedRedGuerrillaLaw:
+		return "mixed-red-guerrilla"
+	case MixedBlueGuerrillaLaw:
+		return "mixed-blue-guerrilla"
+	case HelmboldLaw:
+		return "helmbold"
+	}
+	return "undefined"
+}
+
+// ParseLaw is the inverse of Law.String.
+func ParseLaw(s string) (Law, error) {
+	for l := LinearLaw; l <= HelmboldLaw; l++ {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown Lanchester law %q", s)
+}
+
+// MarshalText lets laws be written by name in JSON.
+func (l Law) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText reads a law by name.
+func (l *Law) UnmarshalText(text []byte) error {
+	x, err := ParseLaw(string(text))
+	if err != nil {
+		return err
+	}
+	*l = x
+	return nil
+}
+
+// Trajectory is the deterministic course of a battle under one of the
+// Lanchester laws. Red[t] and Blue[t] are the force strengths after t
+// turns; the last entries are the strengths when the battle ended.
+type Trajectory struct {
+	Law      Law
+	Red      []float64
+	Blue     []float64
+	Outcome  Outcome
+	Duration float64
+}
+
+// At returns the force strengths after t turns, or the final strengths if
+// the battle was over by then.
+func (tr Trajectory) At(t int) (red, blue float64) {
+	if t >= len(tr.Red) {
+		t = len(tr.Red) - 1
+	}
+	return tr.Red[t], tr.Blue[t]
+}
+
+// coefficients derives the attrition coefficients of a force against its
+// enemy. aimed is the expected kills per unit per turn when every shot
+// finds a target (shot probability times max shots); area is the expected
+// kills per unit per turn per enemy unit when the enemy is too small to
+// absorb all the shots (shot probability alone). Both are scaled by the
+// enemy's mean health.
+func coefficients(shooters, targets []UnitType) (aimed, area float64) {
+	n, health := 0, 0
+	for _, t := range targets {
+		n += t.Count
+		health += t.Count * t.Health
+	}
+	meanHealth := 1.0
+	if n > 0 && health > 0 {
+		meanHealth = float64(health) / float64(n)
+	}
+	n = 0
+	for _, t := range shooters {
+		n += t.Count
+		aimed += float64(t.Count) * t.ShotProb * float64(t.MaxShots)
+		area += float64(t.Count) * t.ShotProb
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return aimed / float64(n) / meanHealth, area / float64(n) / meanHealth
+}
+
+// Solve integrates the given Lanchester law from the initial forces of p,
+// with attrition coefficients derived from each force's shot probability
+// and max shots. The battle ends, as in the agent-based model, when a force
+// falls to its retreat threshold. w is the Helmbold parameter and is
+// ignored by the other laws.
+func Solve(p Parameters, law Law, w float64) Trajectory {
+	redTypes, blueTypes := p.Forces()
+	red0, blue0 := float64(UnitCount(redTypes)), float64(UnitCount(blueTypes))
+	alpha, alphaArea := coefficients(redTypes, blueTypes)
+	beta, betaArea := coefficients(blueTypes, redTypes)
+
+	// dr/dt and db/dt
+	deriv := func(r, b float64) (float64, float64) {
+		if r <= 0 || b <= 0 {
+			return 0, 0
+		}
+		switch law {
+		case LinearLaw:
+			return -betaArea * r * b, -alphaArea * r * b
+		case MixedRedGuerrillaLaw:
+			return -betaArea * r * b, -alpha * r
+		case MixedBlueGuerrillaLaw:
+			return -beta * b, -alphaArea * r * b
+		case HelmboldLaw:
+			return -beta * b * math.Pow(r/b, 1-w), -alpha * r * math.Pow(b/r, 1-w)
+		}
+		return -beta * b, -alpha * r
+	}
+	redBreak := math.Max(red0*p.RedRetreatThreshold, analyticMinForce)
+	blueBreak := math.Max(blue0*p.BlueRetreatThreshold, analyticMinForce)
+	adjudicate := func(r, b float64) Outcome {
+		if r < redBreak && b < blueBreak {
+			return Tie
+		} else if r < redBreak {
+			return BlueVictory
+		} else if b < blueBreak {
+			return RedVictory
+		}
+		return Incomplete
+	}
+
+	tr := Trajectory{Law: law, Red: []float64{red0}, Blue: []float64{blue0}}
+	r, b := red0, blue0
+	stepsPerTurn := int(math.Round(1 / analyticStep))
+	for step := 1; step <= analyticMaxTurns*stepsPerTurn; step++ {
+		// classic fourth-order Runge-Kutta
+		h := analyticStep
+		k1r, k1b := deriv(r, b)
+		k2r, k2b := deriv(r+h/2*k1r, b+h/2*k1b)
+		k3r, k3b := deriv(r+h/2*k2r, b+h/2*k2b)
+		k4r, k4b := deriv(r+h*k3r, b+h*k3b)
+		r = math.Max(0, r+h/6*(k1r+2*k2r+2*k3r+k4r))
+		b = math.Max(0, b+h/6*(k1b+2*k2b+2*k3b+k4b))
+
+		status := adjudicate(r, b)
+		if status != Incomplete || step%stepsPerTurn == 0 {
+			tr.Red = append(tr.Red, r)
+			tr.Blue = append(tr.Blue, b)
+		}
+		if status != Incomplete {
+			tr.Outcome = status
+			tr.Duration = float64(step) * h
+			return tr
+		}
+	}
+	tr.Duration = analyticMaxTurns
+	return tr
+}
@@ -0,0 +1,61 @@
+package lanchester
+
+import (
+	"math"
+	"testing"
+)
+
+// TestSolveInvariants checks that the trajectories of the laws with a
+// closed form keep their invariants: αR² - βB² for the square law,
+// α'R - β'B for the linear law and β'B²/2 - αR when red is a guerrilla
+// force, where α and β are the aimed-fire coefficients of red and blue and
+// α' and β' their area-fire coefficients.
+func TestSolveInvariants(t *testing.T) {
+	p := Parameters{
+		RedSize:      100,
+		RedHealth:    1,
+		RedShotProb:  0.05,
+		RedMaxShots:  2,
+		BlueSize:     80,
+		BlueHealth:   1,
+		BlueShotProb: 0.1,
+		BlueMaxShots: 2,
+	}
+	alpha, alphaArea, beta, betaArea := 0.1, 0.05, 0.2, 0.1
+	for _, c := range []struct {
+		law       Law
+		invariant func(r, b float64) float64
+		outcome   Outcome
+	}{
+		{SquareLaw, func(r, b float64) float64 { return alpha*r*r - beta*b*b }, BlueVictory},
+		// Helmbold's law with W = 1 is the square law
+		{HelmboldLaw, func(r, b float64) float64 { return alpha*r*r - beta*b*b }, BlueVictory},
+		{LinearLaw, func(r, b float64) float64 { return alphaArea*r - betaArea*b }, BlueVictory},
+		{MixedRedGuerrillaLaw, func(r, b float64) float64 { return betaArea*b*b/2 - alpha*r }, BlueVictory},
+	} {
+		tr := Solve(p, c.law, 1)
+		if tr.Outcome != c.outcome {
+			t.Errorf("%v: %v, want %v", c.law, tr.Outcome, c.outcome)
+		}
+		want := c.invariant(tr.Red[0], tr.Blue[0])
+		for i := range tr.Red {
+			if got := c.invariant(tr.Red[i], tr.Blue[i]); math.Abs(got-want) > 1e-6*math.Abs(want) {
+				t.Errorf("%v: invariant %v after %v turns, %v at the start", c.law, got, i, want)
+				break
+			}
+		}
+	}
+
+	// the square law's closed form for the strengths over time
+	tr := Solve(p, SquareLaw, 0)
+	g := math.Sqrt(alpha * beta)
+	for i := range tr.Red[:len(tr.Red)-1] {
+		x := g * float64(i)
+		r := 100*math.Cosh(x) - math.Sqrt(beta/alpha)*80*math.Sinh(x)
+		b := 80*math.Cosh(x) - math.Sqrt(alpha/beta)*100*math.Sinh(x)
+		if math.Abs(tr.Red[i]-r) > 1e-6 || math.Abs(tr.Blue[i]-b) > 1e-6 {
+			t.Errorf("square law after %v turns: red %v and blue %v, want %v and %v", i, tr.Red[i], tr.Blue[i], r, b)
+			break
+		}
+	}
+}
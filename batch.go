@@ -1,30 +1,89 @@
-package main
+package lanchester
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 )
 
-//parameter set holds the potential values for a parameter sweep
-type parameterSet struct {
-	Verbose              bool
-	ActivationOrder      []ActivationOrder
-	RedSize              []int
-	RedHealth            []int
-	RedShotProb          []float64
-	RedMaxShots          []int
-	RedRetreatThreshold  []float64
-	BlueSize             []int
-	BlueHealth           []int
-	BlueShotProb         []float64
-	BlueMaxShots         []int
-	BlueRetreatThreshold []float64
+// Settings describe a batch of runs. Each ranged field holds
+// [min, max, step]; a single run uses the min values, and a sweep steps
+// from min to max, or takes the number of evenly spaced levels SweepLevels
+// gives a real-valued field. RedUnits and BlueUnits, if given, fix the
+// composition of that force for every run, and the targeting policies,
+// reinforcements, ammunition, resupply, morale, turn limits, TrackDead and
+// Grid likewise apply to every run. Sides and Hostility, if given, set up
+// a battle between named sides instead; the ranged red and blue fields
+// then have no effect.
+// Resolution is the least resolution of a fractional factorial screening
+// design, III if 0. Replicates, MorrisLevels and Bootstrap set the battles
+// per design point (1 if 0), the grid levels of a Morris design (4 if 0)
+// and the bootstrap resamples of a sensitivity analysis (1000 if 0).
+// Aggregate writes one row per design point, by way of an Aggregator,
+// instead of one per run.
+type Settings struct {
+	Filename             string            `json:"filename"`
+	WriteDynamics        bool              `json:"writeDynamics"`
+	BatchMode            BatchMode         `json:"batchMode"`
+	Niter                int               `json:"niter"`
+	Verbose              bool              `json:"verbose"`
+	Workers              int               `json:"workers"`
+	Seed                 int64             `json:"seed"`
+	ActivationOrder      []ActivationOrder `json:"activationOrder"`
+	RedSize              [3]int            `json:"RedSize"`
+	RedHealth            [3]int            `json:"RedHealth"`
+	RedShotProb          [3]float64        `json:"RedShotProb"`
+	RedMaxShots          [3]int            `json:"RedMaxShots"`
+	RedRetreatThreshold  [3]float64        `json:"RedRetreatThreshold"`
+	BlueSize             [3]int            `json:"BlueSize"`
+	BlueHealth           [3]int            `json:"BlueHealth"`
+	BlueShotProb         [3]float64        `json:"BlueShotProb"`
+	BlueMaxShots         [3]int            `json:"BlueMaxShots"`
+	BlueRetreatThreshold [3]float64        `json:"BlueRetreatThreshold"`
+	RedUnits             []UnitType        `json:"redUnits"`
+	BlueUnits            []UnitType        `json:"blueUnits"`
+	RedTargeting         Targeting         `json:"redTargeting"`
+	BlueTargeting        Targeting         `json:"blueTargeting"`
+	RedReinforcements    []Reinforcement   `json:"redReinforcements"`
+	BlueReinforcements   []Reinforcement   `json:"blueReinforcements"`
+	RedAmmo              int               `json:"redAmmo"`
+	BlueAmmo             int               `json:"blueAmmo"`
+	RedResupply          float64           `json:"redResupply"`
+	BlueResupply         float64           `json:"blueResupply"`
+	RedMorale            Morale            `json:"redMorale"`
+	BlueMorale           Morale            `json:"blueMorale"`
+	MaxTurns             int               `json:"maxTurns"`
+	StallTurns           int               `json:"stallTurns"`
+	TrackDead            bool              `json:"trackDead"`
+	Grid                 *Grid             `json:"grid"`
+	Sides                []Side            `json:"sides"`
+	Hostility            [][]bool          `json:"hostility"`
+	AnalyticLaws         []Law             `json:"analyticLaws"`
+	HelmboldW            float64           `json:"helmboldW"`
+	LHSCriterion         string            `json:"lhsCriterion"`
+	LHSCandidates        int               `json:"lhsCandidates"`
+	SweepLevels          map[string]int    `json:"sweepLevels"`
+	Resolution           int               `json:"resolution"`
+	Replicates           int               `json:"replicates"`
+	MorrisLevels         int               `json:"morrisLevels"`
+	Bootstrap            int               `json:"bootstrap"`
+	Aggregate            bool              `json:"aggregate"`
+
+	// whether the parameter file or an override gave the seed
+	seeded bool
+}
+
+// Seeded reports whether the seed was chosen: whether it is not 0, or was
+// given, even as 0, in the parameter file or an override.
+func (set *Settings) Seeded() bool {
+	return set.seeded || set.Seed != 0
 }
 
-// runOnce uses the base values from parameters.json to feed one run
-func runOnce() {
-	par = parameters{
-		Verbose:              set.Verbose,
+// Base returns the parameters for a single run, using the min value of
+// every range.
+func (set *Settings) Base() Parameters {
+	return set.withForces(Parameters{
 		ActivationOrder:      set.ActivationOrder[0],
 		RedSize:              set.RedSize[0],
 		RedHealth:            set.RedHealth[0],
@@ -36,206 +95,210 @@ func runOnce() {
 		BlueShotProb:         set.BlueShotProb[0],
 		BlueMaxShots:         set.BlueMaxShots[0],
 		BlueRetreatThreshold: set.BlueRetreatThreshold[0],
-	}
-	runModel(par, runNum)
-
+	})
 }
 
-// calculateSweep generates the parameter set and returns
-// its size so that the user can be warned
-
-// TODO: There is a bug in this function causing it to return
-// inaccurate parameter sets due to inaccuracies in floating-point
-// arithmetic. This should not be too difficult to fix at some point.
-func caluculateSweep() (int, parameterSet) {
-	//TODO: Use reflect to make this less horrible.
-	_ = "breakpoint"
-	sweepSize := 1
-	sweepSize *= len(set.ActivationOrder)
-	parSet := parameterSet{
-		ActivationOrder:      set.ActivationOrder,
-		RedSize:              make([]int, 0),
-		RedHealth:            make([]int, 0),
-		RedShotProb:          make([]float64, 0),
-		RedMaxShots:          make([]int, 0),
-		RedRetreatThreshold:  make([]float64, 0),
-		BlueSize:             make([]int, 0),
-		BlueHealth:           make([]int, 0),
-		BlueShotProb:         make([]float64, 0),
-		BlueMaxShots:         make([]int, 0),
-		BlueRetreatThreshold: make([]float64, 0),
-	}
-
-	if set.RedSize[2] != 0 {
-		sweepSize *= (set.RedSize[1] - (set.RedSize[0] - set.RedSize[2])) / set.RedSize[2]
-		for i := set.RedSize[0]; i <= set.RedSize[1]; i += set.RedSize[2] {
-			parSet.RedSize = append(parSet.RedSize, i)
-		}
-	} else {
-		parSet.RedSize = append(parSet.RedSize, set.RedSize[0])
+// Each calls fn with the parameters of every run in the batch, in run
+// order. rng drives the random batch modes.
+func (set *Settings) Each(rng *rand.Rand, fn func(Parameters)) error {
+	if len(set.ActivationOrder) == 0 {
+		return errors.New("no activation order given")
 	}
-	if set.BlueSize[2] != 0 {
-		sweepSize *= (set.BlueSize[1] - (set.BlueSize[0] - set.BlueSize[2])) / set.BlueSize[2]
-		for i := set.BlueSize[0]; i <= set.BlueSize[1]; i += set.BlueSize[2] {
-			parSet.BlueSize = append(parSet.BlueSize, i)
-		}
-	} else {
-		parSet.BlueSize = append(parSet.BlueSize, set.BlueSize[0])
+	next := fn
+	fn = func(p Parameters) {
+		next(set.withForces(p))
+	}
+	switch set.BatchMode {
+	case SingleRun:
+		fn(set.Base())
+	case ParameterSweep:
+		set.Sweep(fn)
+	case MonteCarlo:
+		set.MonteCarlo(rng, fn)
+	case LatinHypercube:
+		return set.LatinHypercube(rng, fn)
+	case FractionalFactorial, PlackettBurman:
+		return set.Screen(fn)
+	case SobolSequence, HaltonSequence:
+		return set.QuasiRandom(rng, fn)
+	case SobolIndices, Morris:
+		return set.Analyse(fn)
+	case Exact:
+		return errors.New("exact mode solves the model instead of running battles")
+	default:
+		return errors.New("unknown batch mode")
 	}
+	return nil
+}
 
-	if set.RedHealth[2] != 0 {
-		sweepSize *= (set.RedHealth[1] - (set.RedHealth[0] - set.RedHealth[2])) / set.RedHealth[2]
-		for i := set.RedHealth[0]; i <= set.RedHealth[1]; i += set.RedHealth[2] {
-			parSet.RedHealth = append(parSet.RedHealth, i)
-		}
-	} else {
-		parSet.RedHealth = append(parSet.RedHealth, set.RedHealth[0])
+// withForces applies the fixed force compositions and targeting policies
+// to p.
+func (set *Settings) withForces(p Parameters) Parameters {
+	p.RedTargeting, p.BlueTargeting = set.RedTargeting, set.BlueTargeting
+	p.RedReinforcements, p.BlueReinforcements = set.RedReinforcements, set.BlueReinforcements
+	p.RedAmmo, p.BlueAmmo = set.RedAmmo, set.BlueAmmo
+	p.RedResupply, p.BlueResupply = set.RedResupply, set.BlueResupply
+	p.RedMorale, p.BlueMorale = set.RedMorale, set.BlueMorale
+	p.MaxTurns, p.StallTurns = set.MaxTurns, set.StallTurns
+	p.TrackDead, p.Grid = set.TrackDead, set.Grid
+	p.Sides, p.Hostility = set.Sides, set.Hostility
+	if len(set.RedUnits) > 0 {
+		p.RedUnits = set.RedUnits
+		p.RedSize = UnitCount(set.RedUnits)
 	}
-	if set.BlueHealth[2] != 0 {
-		sweepSize *= (set.BlueHealth[1] - (set.BlueHealth[0] - set.BlueHealth[2])) / set.BlueHealth[2]
-		for i := set.BlueHealth[0]; i <= set.BlueHealth[1]; i += set.BlueHealth[2] {
-			parSet.BlueHealth = append(parSet.BlueHealth, i)
-		}
-	} else {
-		parSet.BlueHealth = append(parSet.BlueHealth, set.BlueHealth[0])
+	if len(set.BlueUnits) > 0 {
+		p.BlueUnits = set.BlueUnits
+		p.BlueSize = UnitCount(set.BlueUnits)
 	}
+	return p
+}
 
-	if set.RedShotProb[2] != 0.0 {
-		sweepSize *= int((set.RedShotProb[1] - (set.RedShotProb[0] - set.RedShotProb[2])) / set.RedShotProb[2])
-		for i := set.RedShotProb[0]; i <= set.RedShotProb[1]; i += set.RedShotProb[2] {
-			parSet.RedShotProb = append(parSet.RedShotProb, i)
-		}
-	} else {
-		parSet.RedShotProb = append(parSet.RedShotProb, set.RedShotProb[0])
-	}
-	if set.BlueShotProb[2] != 0.0 {
-		sweepSize *= int((set.BlueShotProb[1] - (set.BlueShotProb[0] - set.BlueShotProb[2])) / set.BlueShotProb[2])
-		for i := set.BlueShotProb[0]; i <= set.BlueShotProb[1]; i += set.BlueShotProb[2] {
-			parSet.BlueShotProb = append(parSet.BlueShotProb, i)
+// Reinforced reports whether any force has a reinforcement schedule.
+func (set *Settings) Reinforced() bool {
+	for _, side := range set.withForces(Parameters{}).AllSides() {
+		if len(side.Reinforcements) > 0 {
+			return true
 		}
-	} else {
-		parSet.BlueShotProb = append(parSet.BlueShotProb, set.BlueShotProb[0])
 	}
+	return false
+}
 
-	if set.RedMaxShots[2] != 0.0 {
-		sweepSize *= int((set.RedMaxShots[1] - (set.RedMaxShots[0] - set.RedMaxShots[2])) / set.RedMaxShots[2])
-		for i := set.RedMaxShots[0]; i <= set.RedMaxShots[1]; i += set.RedMaxShots[2] {
-			parSet.RedMaxShots = append(parSet.RedMaxShots, i)
+// Rationed reports whether any force has limited ammunition or is
+// resupplied.
+func (set *Settings) Rationed() bool {
+	for _, side := range set.withForces(Parameters{}).AllSides() {
+		if rationed(side.Units) || side.Resupply > 0 {
+			return true
 		}
-	} else {
-		parSet.RedMaxShots = append(parSet.RedMaxShots, set.RedMaxShots[0])
 	}
-	if set.BlueMaxShots[2] != 0.0 {
-		sweepSize *= int((set.BlueMaxShots[1] - (set.BlueMaxShots[0] - set.BlueMaxShots[2])) / set.BlueMaxShots[2])
-		for i := set.BlueMaxShots[0]; i <= set.BlueMaxShots[1]; i += set.BlueMaxShots[2] {
-			parSet.BlueMaxShots = append(parSet.BlueMaxShots, i)
+	return false
+}
+
+// Suppressed reports whether any force is subject to morale.
+func (set *Settings) Suppressed() bool {
+	for _, side := range set.withForces(Parameters{}).AllSides() {
+		if side.Morale != (Morale{}) {
+			return true
 		}
-	} else {
-		parSet.BlueMaxShots = append(parSet.BlueMaxShots, set.BlueMaxShots[0])
 	}
+	return false
+}
 
-	if set.RedRetreatThreshold[2] != 0.0 {
-		sweepSize *= int((set.RedRetreatThreshold[1] - (set.RedRetreatThreshold[0] - set.RedRetreatThreshold[2])) / set.RedRetreatThreshold[2])
-		for i := set.RedRetreatThreshold[0]; i <= set.RedRetreatThreshold[1]; i += set.RedRetreatThreshold[2] {
-			parSet.RedRetreatThreshold = append(parSet.RedRetreatThreshold, i)
+// ExactResults solves the base parameters exactly under each of the
+// activation orders.
+func (set *Settings) ExactResults() ([]ExactResult, error) {
+	results := make([]ExactResult, len(set.ActivationOrder))
+	for i, a := range set.ActivationOrder {
+		p := set.Base()
+		p.ActivationOrder = a
+		var err error
+		if results[i], err = SolveExact(p); err != nil {
+			return nil, fmt.Errorf("%v: %v", a, err)
 		}
-	} else {
-		parSet.RedRetreatThreshold = append(parSet.RedRetreatThreshold, set.RedRetreatThreshold[0])
 	}
-	if set.BlueRetreatThreshold[2] != 0.0 {
-		sweepSize *= int((set.BlueRetreatThreshold[1] - (set.BlueRetreatThreshold[0] - set.BlueRetreatThreshold[2])) / set.BlueRetreatThreshold[2])
-		for i := set.BlueRetreatThreshold[0]; i <= set.BlueRetreatThreshold[1]; i += set.BlueRetreatThreshold[2] {
-			parSet.BlueRetreatThreshold = append(parSet.BlueRetreatThreshold, i)
-		}
-	} else {
-		parSet.BlueRetreatThreshold = append(parSet.BlueRetreatThreshold, set.BlueRetreatThreshold[0])
+	return results, nil
+}
+
+// SweepSize returns the number of runs in a parameter sweep so that the
+// user can be warned.
+func (set *Settings) SweepSize() int {
+	n := Factorial(set.Axes()).Size()
+	if set.Niter > 0 && n > math.MaxInt/set.Niter {
+		return math.MaxInt
 	}
-	return sweepSize * set.Niter, parSet
+	return n * set.Niter
 }
 
-// Execute the parameter sweep
-func executeSweep(ps parameterSet) {
-	ps.Verbose = set.Verbose
-	par.Verbose = ps.Verbose
-	// set the parameters to the initial values
-	par = parameters{
-		Verbose:              set.Verbose,
-		ActivationOrder:      set.ActivationOrder[0],
-		RedSize:              set.RedSize[0],
-		RedHealth:            set.RedHealth[0],
-		RedShotProb:          set.RedShotProb[0],
-		RedMaxShots:          set.RedMaxShots[0],
-		RedRetreatThreshold:  set.RedRetreatThreshold[0],
-		BlueSize:             set.BlueSize[0],
-		BlueHealth:           set.BlueHealth[0],
-		BlueShotProb:         set.BlueShotProb[0],
-		BlueMaxShots:         set.BlueMaxShots[0],
-		BlueRetreatThreshold: set.BlueRetreatThreshold[0],
+// BatchSize returns the number of runs in the batch, or 0 in exact mode.
+func (set *Settings) BatchSize() int {
+	switch set.BatchMode {
+	case SingleRun:
+		return 1
+	case ParameterSweep:
+		return set.SweepSize()
+	case MonteCarlo, LatinHypercube, SobolSequence, HaltonSequence:
+		return set.Niter
+	case FractionalFactorial, PlackettBurman:
+		d, err := set.Screening()
+		if err != nil {
+			return 0
+		}
+		return len(d.Runs) * len(set.ActivationOrder) * set.Niter
+	case SobolIndices, Morris:
+		d, err := set.Sensitivity()
+		if err != nil {
+			return 0
+		}
+		return d.Runs()
 	}
+	return 0
+}
 
-	// TRIGGER WARNING
-	for _, e := range ps.ActivationOrder {
-		par.ActivationOrder = e
-		for _, e := range ps.RedSize {
-			par.RedSize = e
-			for _, e := range ps.RedHealth {
-				par.RedHealth = e
-				for _, e := range ps.RedShotProb {
-					par.RedShotProb = e
-					for _, e := range ps.RedMaxShots {
-						par.RedMaxShots = e
-						for _, e := range ps.RedRetreatThreshold {
-							par.RedRetreatThreshold = e
-							for _, e := range ps.BlueSize {
-								par.BlueSize = e
-								for _, e := range ps.BlueHealth {
-									par.BlueHealth = e
-									for _, e := range ps.BlueShotProb {
-										par.BlueShotProb = e
-										for _, e := range ps.BlueMaxShots {
-											par.BlueMaxShots = e
-											for _, e := range ps.BlueRetreatThreshold {
-												par.BlueRetreatThreshold = e
-												for i := 0; i < set.Niter; i++ {
-													runModel(par, runNum)
-													runNum++
-												}
-											}
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
+// Sweep calls fn for every point of the full factorial design over
+// set.Axes, set.Niter times per point. The last axis changes fastest.
+func (set *Settings) Sweep(fn func(Parameters)) {
+	d := Factorial(set.Axes())
+	base := set.Base()
+	for i, n := 0, d.Size(); i < n; i++ {
+		par := d.Parameters(base, i)
+		for k := 0; k < set.Niter; k++ {
+			fn(par)
 		}
 	}
 }
 
-func monteCarloRun() {
+// MonteCarlo calls fn with set.Niter parameter sets drawn uniformly from
+// the [min,max] range of every parameter. Fields that the unit types or
+// the sides override are left at their min.
+func (set *Settings) MonteCarlo(rng *rand.Rand, fn func(Parameters)) {
+	intn := func(name string, r [3]int) int {
+		if set.overridden(name) {
+			return r[0]
+		}
+		return rng.Intn(r[1]-r[0]+1) + r[0]
+	}
+	uniform := func(name string, r [3]float64) float64 {
+		if set.overridden(name) {
+			return r[0]
+		}
+		return r[0] + (r[1]-r[0])*rng.Float64()
+	}
 	for i := 0; i < set.Niter; i++ {
 
-		par = parameters{
-			ActivationOrder:      set.ActivationOrder[rand.Intn(len(set.ActivationOrder))],
-			RedSize:              rand.Intn(set.RedSize[1]-set.RedSize[0]+1) + set.RedSize[0],
-			RedHealth:            rand.Intn(set.RedHealth[1]-set.RedHealth[0]+1) + set.RedHealth[0],
-			RedShotProb:          set.RedShotProb[0] + (set.RedShotProb[1]-set.RedShotProb[0])*rand.Float64(),
-			RedMaxShots:          rand.Intn(set.RedMaxShots[1]-set.RedMaxShots[0]+1) + set.RedMaxShots[0],
-			RedRetreatThreshold:  set.RedRetreatThreshold[0] + (set.RedRetreatThreshold[1]-set.RedRetreatThreshold[0])*rand.Float64(),
-			BlueSize:             rand.Intn(set.BlueSize[1]-set.BlueSize[0]+1) + set.BlueSize[0],
-			BlueHealth:           rand.Intn(set.BlueHealth[1]-set.BlueHealth[0]+1) + set.BlueHealth[0],
-			BlueShotProb:         set.BlueShotProb[0] + (set.BlueShotProb[1]-set.BlueShotProb[0])*rand.Float64(),
-			BlueMaxShots:         rand.Intn(set.BlueMaxShots[1]-set.BlueMaxShots[0]+1) + set.BlueMaxShots[0],
-			BlueRetreatThreshold: set.BlueRetreatThreshold[0] + (set.BlueRetreatThreshold[1]-set.BlueRetreatThreshold[0])*rand.Float64(),
+		par := Parameters{
+			ActivationOrder:      set.ActivationOrder[rng.Intn(len(set.ActivationOrder))],
+			RedSize:              intn("RedSize", set.RedSize),
+			RedHealth:            intn("RedHealth", set.RedHealth),
+			RedShotProb:          uniform("RedShotProb", set.RedShotProb),
+			RedMaxShots:          intn("RedMaxShots", set.RedMaxShots),
+			RedRetreatThreshold:  uniform("RedRetreatThreshold", set.RedRetreatThreshold),
+			BlueSize:             intn("BlueSize", set.BlueSize),
+			BlueHealth:           intn("BlueHealth", set.BlueHealth),
+			BlueShotProb:         uniform("BlueShotProb", set.BlueShotProb),
+			BlueMaxShots:         intn("BlueMaxShots", set.BlueMaxShots),
+			BlueRetreatThreshold: uniform("BlueRetreatThreshold", set.BlueRetreatThreshold),
 		}
-		runModel(par, runNum)
+		fn(par)
 
 	}
 }
 
-func latinHypercubeRun() {
-	fmt.Println("Error: Not yet implemented")
-
-	return
+// LatinHypercube samples set.Niter points from a Latin hypercube over
+// the ranges of the settings that vary, as QuasiRandom does, and calls fn
+// once per point.
+func (set *Settings) LatinHypercube(rng *rand.Rand, fn func(Parameters)) error {
+	if set.Niter <= 0 {
+		return errors.New("Latin hypercube needs niter > 0")
+	}
+	rs := set.sampled()
+	design := set.buildLHS(rng, set.Niter, len(rs))
+	base := set.Base()
+	for _, u := range design {
+		par := base
+		for d, r := range rs {
+			Axis{Name: r.name}.Set(&par, r.at(u[d]))
+		}
+		fn(par)
+	}
+	return nil
 }
@@ -0,0 +1,271 @@
+package lanchester
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// AxisKind says how the levels of an axis are to be read.
+type AxisKind int
+
+const (
+	// Whole numbers
+	IntegerAxis AxisKind = iota
+	// Real numbers
+	FloatAxis
+	// Unordered choices, such as activation orders
+	CategoricalAxis
+)
+
+// Axis is one parameter of an experimental design and the levels it takes.
+// Name is the field of Parameters that the axis sets.
+type Axis struct {
+	Name   string
+	Kind   AxisKind
+	Levels []float64
+}
+
+// IntegerRange is the axis of whole numbers from min to max in steps of
+// step. A step of 0 holds the axis at min.
+func IntegerRange(name string, min, max, step int) Axis {
+	a := Axis{Name: name, Kind: IntegerAxis}
+	if step <= 0 {
+		max, step = min, 1
+	}
+	for x := min; x <= max; x += step {
+		a.Levels = append(a.Levels, float64(x))
+	}
+	return a
+}
+
+// DecimalRange is the axis of real numbers from min to max in steps of
+// step, counted in the decimal places of the three numbers so that, say,
+// 0 to 0.3 in steps of 0.1 gives 0, 0.1, 0.2 and 0.3 exactly. A step of 0
+// holds the axis at min.
+func DecimalRange(name string, min, max, step float64) Axis {
+	a := Axis{Name: name, Kind: FloatAxis}
+	if step <= 0 || max <= min {
+		a.Levels = []float64{min}
+		return a
+	}
+	d := decimals(min)
+	if x := decimals(max); x > d {
+		d = x
+	}
+	if x := decimals(step); x > d {
+		d = x
+	}
+	scale := math.Pow10(d)
+	lo, hi, by := math.Round(min*scale), math.Round(max*scale), math.Round(step*scale)
+	if d > 15 || math.Max(math.Abs(lo), math.Abs(hi)) > 1<<53 || by == 0 {
+		// too fine for decimal steps; fall back on multiples of the step
+		for k := 0.0; min+k*step <= max; k++ {
+			a.Levels = append(a.Levels, min+k*step)
+		}
+		return a
+	}
+	for x := lo; x <= hi; x += by {
+		a.Levels = append(a.Levels, x/scale)
+	}
+	return a
+}
+
+// Linspace is the axis of n evenly spaced real numbers from min to max
+// inclusive.
+func Linspace(name string, min, max float64, n int) Axis {
+	a := Axis{Name: name, Kind: FloatAxis}
+	if n <= 1 {
+		a.Levels = []float64{min}
+		return a
+	}
+	for k := 0; k < n; k++ {
+		a.Levels = append(a.Levels, min+(max-min)*float64(k)/float64(n-1))
+	}
+	a.Levels[n-1] = max
+	return a
+}
+
+// Categorical is the axis of the given choices, coded as numbers.
+func Categorical(name string, levels ...float64) Axis {
+	return Axis{Name: name, Kind: CategoricalAxis, Levels: levels}
+}
+
+// The number of decimal places in the shortest representation of x
+func decimals(x float64) int {
+	s := strconv.FormatFloat(x, 'g', -1, 64)
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, _ = strconv.Atoi(s[i+1:])
+		s = s[:i]
+	}
+	d := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		d = len(s) - i - 1
+	}
+	if d -= exp; d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// Set sets the axis's field of p to x.
+func (a Axis) Set(p *Parameters, x float64) {
+	f := reflect.ValueOf(p).Elem().FieldByName(a.Name)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.SetInt(int64(math.Round(x)))
+	case reflect.Float32, reflect.Float64:
+		f.SetFloat(x)
+	default:
+		panic(fmt.Sprintf("lanchester: no numeric parameter %v", a.Name))
+	}
+}
+
+// Get returns the axis's field of p.
+func (a Axis) Get(p Parameters) float64 {
+	f := reflect.ValueOf(p).FieldByName(a.Name)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(f.Int())
+	case reflect.Float32, reflect.Float64:
+		return f.Float()
+	}
+	panic(fmt.Sprintf("lanchester: no numeric parameter %v", a.Name))
+}
+
+// Factorial is a full factorial design: every combination of the levels of
+// its axes. Points are numbered as in a mixed-radix number whose last axis
+// is the fastest-changing digit.
+type Factorial []Axis
+
+// Size returns the number of points in the design.
+func (d Factorial) Size() int {
+	n := 1
+	for _, a := range d {
+		if len(a.Levels) > 0 && n > math.MaxInt/len(a.Levels) {
+			return math.MaxInt
+		}
+		n *= len(a.Levels)
+	}
+	return n
+}
+
+// Point returns the level of each axis at the i-th point of the design.
+func (d Factorial) Point(i int) []float64 {
+	x := make([]float64, len(d))
+	for k := len(d) - 1; k >= 0; k-- {
+		n := len(d[k].Levels)
+		x[k] = d[k].Levels[i%n]
+		i /= n
+	}
+	return x
+}
+
+// Parameters returns base with the axes set to the i-th point of the
+// design.
+func (d Factorial) Parameters(base Parameters, i int) Parameters {
+	for k, x := range d.Point(i) {
+		d[k].Set(&base, x)
+	}
+	return base
+}
+
+// Axes returns the axes over which the settings range: a categorical axis
+// for ActivationOrder and one for each [min, max, step] field, in the order
+// of the fields. Fields named in SweepLevels take that many evenly spaced
+// levels instead of stepping.
+func (set *Settings) Axes() []Axis {
+	var axes []Axis
+	for _, r := range set.ranges() {
+		switch r.kind {
+		case CategoricalAxis:
+			axes = append(axes, Categorical(r.name, r.levels...))
+		case IntegerAxis:
+			axes = append(axes, IntegerRange(r.name, int(r.min), int(r.max), int(r.step)))
+		default:
+			if n, ok := set.sweepLevels(r.name); ok {
+				axes = append(axes, Linspace(r.name, r.min, r.max, n))
+			} else {
+				axes = append(axes, DecimalRange(r.name, r.min, r.max, r.step))
+			}
+		}
+	}
+	return axes
+}
+
+// parameterRange is a field of Settings over which a batch ranges: the
+// levels of a categorical field, or the [min, max, step] of a numeric one.
+type parameterRange struct {
+	name           string
+	kind           AxisKind
+	min, max, step float64
+	levels         []float64
+}
+
+// ranges returns the fields over which the settings range, in the order of
+// the fields. Any slice or [min, max, step] field of Settings whose name
+// is a field of Parameters of the slice's element type, or of the range's
+// type, counts, so that new parameters need no further code.
+func (set *Settings) ranges() []parameterRange {
+	var rs []parameterRange
+	s := reflect.ValueOf(set).Elem()
+	params := reflect.TypeOf(Parameters{})
+	for i := 0; i < s.NumField(); i++ {
+		f := s.Type().Field(i)
+		p, ok := params.FieldByName(f.Name)
+		if !ok {
+			continue
+		}
+		v := s.Field(i)
+		switch {
+		case f.Type.Kind() == reflect.Slice && f.Type.Elem() == p.Type && p.Type.Kind() == reflect.Int:
+			r := parameterRange{name: f.Name, kind: CategoricalAxis, levels: make([]float64, v.Len())}
+			for k := range r.levels {
+				r.levels[k] = float64(v.Index(k).Int())
+			}
+			rs = append(rs, r)
+		case f.Type == reflect.TypeOf([3]int{}) && p.Type.Kind() == reflect.Int:
+			x := v.Interface().([3]int)
+			rs = append(rs, parameterRange{name: f.Name, kind: IntegerAxis, min: float64(x[0]), max: float64(x[1]), step: float64(x[2])})
+		case f.Type == reflect.TypeOf([3]float64{}) && p.Type.Kind() == reflect.Float64:
+			x := v.Interface().([3]float64)
+			rs = append(rs, parameterRange{name: f.Name, kind: FloatAxis, min: x[0], max: x[1], step: x[2]})
+		}
+	}
+	return rs
+}
+
+// overridden reports whether a ranged field has no effect on the battles:
+// the size, health, shot probability and max shots of a force made of unit
+// types, and every red and blue field in a battle between sides.
+func (set *Settings) overridden(name string) bool {
+	if len(set.Sides) > 0 {
+		return name != "ActivationOrder"
+	}
+	for _, f := range []struct {
+		force string
+		units []UnitType
+	}{{"Red", set.RedUnits}, {"Blue", set.BlueUnits}} {
+		if len(f.units) == 0 {
+			continue
+		}
+		switch name {
+		case f.force + "Size", f.force + "Health", f.force + "ShotProb", f.force + "MaxShots":
+			return true
+		}
+	}
+	return false
+}
+
+// The number of levels SweepLevels gives the named field, if any
+func (set *Settings) sweepLevels(name string) (int, bool) {
+	for k, n := range set.SweepLevels {
+		if strings.EqualFold(k, name) {
+			return n, true
+		}
+	}
+	return 0, false
+}
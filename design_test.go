@@ -0,0 +1,93 @@
+package lanchester
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRanges(t *testing.T) {
+	for _, c := range []struct {
+		axis Axis
+		want []float64
+	}{
+		{IntegerRange("RedSize", 10, 20, 5), []float64{10, 15, 20}},
+		{IntegerRange("RedSize", 10, 21, 5), []float64{10, 15, 20}},
+		{IntegerRange("RedSize", 10, 20, 0), []float64{10}},
+		{DecimalRange("RedShotProb", 0, 0.3, 0.1), []float64{0, 0.1, 0.2, 0.3}},
+		{DecimalRange("RedShotProb", 0.01, 0.05, 0.01), []float64{0.01, 0.02, 0.03, 0.04, 0.05}},
+		{DecimalRange("RedShotProb", 0.2, 0.2, 0), []float64{0.2}},
+		{Linspace("RedShotProb", 0, 1, 5), []float64{0, 0.25, 0.5, 0.75, 1}},
+		{Linspace("RedShotProb", 0.1, 0.7, 1), []float64{0.1}},
+	} {
+		if !reflect.DeepEqual(c.axis.Levels, c.want) {
+			t.Errorf("%v levels %v, want %v", c.axis.Name, c.axis.Levels, c.want)
+		}
+	}
+	// the last level is the max itself, however the steps round
+	if a := Linspace("RedShotProb", 0, 0.3, 4); a.Levels[3] != 0.3 {
+		t.Errorf("Linspace ends at %v, want 0.3", a.Levels[3])
+	}
+}
+
+func TestFactorial(t *testing.T) {
+	d := Factorial{
+		Categorical("ActivationOrder", 0, 2),
+		IntegerRange("RedSize", 10, 30, 10),
+		DecimalRange("BlueShotProb", 0.1, 0.2, 0.1),
+	}
+	if n := d.Size(); n != 12 {
+		t.Fatalf("size %v, want 12", n)
+	}
+	// the last axis changes fastest
+	for i, want := range [][]float64{
+		{0, 10, 0.1}, {0, 10, 0.2}, {0, 20, 0.1}, {0, 20, 0.2}, {0, 30, 0.1}, {0, 30, 0.2},
+		{2, 10, 0.1}, {2, 10, 0.2}, {2, 20, 0.1}, {2, 20, 0.2}, {2, 30, 0.1}, {2, 30, 0.2},
+	} {
+		if got := d.Point(i); !reflect.DeepEqual(got, want) {
+			t.Errorf("point %v is %v, want %v", i, got, want)
+		}
+	}
+	p := d.Parameters(Parameters{RedShotProb: 0.5}, 7)
+	if p.ActivationOrder != RandomAsynchronous || p.RedSize != 10 || p.BlueShotProb != 0.2 || p.RedShotProb != 0.5 {
+		t.Errorf("point 7 sets %+v", p)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	set := &Settings{
+		Niter:           2,
+		ActivationOrder: []ActivationOrder{RandomSynchronous, UniformAsynchronous},
+		RedSize:         [3]int{10, 20, 10},
+		RedHealth:       [3]int{1, 1, 0},
+		RedShotProb:     [3]float64{0.1, 0.3, 0.1},
+		RedMaxShots:     [3]int{1, 1, 0},
+		BlueSize:        [3]int{10, 10, 0},
+		BlueHealth:      [3]int{1, 1, 0},
+		BlueShotProb:    [3]float64{0.1, 0.2, 0},
+		BlueMaxShots:    [3]int{2, 2, 0},
+		SweepLevels:     map[string]int{"blueShotProb": 3},
+	}
+	type point struct {
+		order             ActivationOrder
+		size              int
+		redProb, blueProb float64
+	}
+	seen := make(map[point]int)
+	n := 0
+	set.Sweep(func(p Parameters) {
+		seen[point{p.ActivationOrder, p.RedSize, p.RedShotProb, p.BlueShotProb}]++
+		n++
+	})
+	// 2 orders, 2 red sizes, 3 red and 3 blue shot probabilities
+	if want := 2 * 2 * 3 * 3 * 2; n != want || set.SweepSize() != want {
+		t.Errorf("swept %v runs, SweepSize %v, want %v", n, set.SweepSize(), want)
+	}
+	for x, k := range seen {
+		if k != set.Niter {
+			t.Errorf("%+v run %v times, want %v", x, k, set.Niter)
+		}
+	}
+	if len(seen) != 36 {
+		t.Errorf("%v distinct points, want 36", len(seen))
+	}
+}
@@ -0,0 +1,167 @@
+package lanchester
+
+import (
+	"math/rand"
+	"reflect"
+)
+
+// activationBins is the number of bins in an activation histogram: units
+// activated 0, 1, 2, or 3 or more times in a turn.
+const activationBins = 4
+
+// activationCounter tallies how many times each unit alive at the start of
+// a turn is activated during that turn.
+type activationCounter struct {
+	counts map[*force]map[int]int
+	alive  map[*force][]int
+	hist   [activationBins]int
+}
+
+func newActivationCounter(b *Battle) *activationCounter {
+	c := &activationCounter{
+		counts: make(map[*force]map[int]int),
+		alive:  make(map[*force][]int),
+	}
+	for i := range b.forces {
+		c.counts[&b.forces[i]] = make(map[int]int)
+	}
+	c.snapshot(b)
+	return c
+}
+
+func (c *activationCounter) activate(f *force, id int) {
+	c.counts[f][id]++
+}
+
+// endTurn adds the finished turn to the histogram and starts the next.
+func (c *activationCounter) endTurn(b *Battle) {
+	for f, ids := range c.alive {
+		for _, id := range ids {
+			n := c.counts[f][id]
+			if n >= activationBins {
+				n = activationBins - 1
+			}
+			c.hist[n]++
+		}
+		c.counts[f] = make(map[int]int)
+	}
+	c.snapshot(b)
+}
+
+func (c *activationCounter) snapshot(b *Battle) {
+	for i := range b.forces {
+		f := &b.forces[i]
+		ids := make([]int, f.size())
+		for i := range ids {
+			ids[i] = f.living(i).id
+		}
+		c.alive[f] = ids
+	}
+}
+
+// ActivationComparison compares how often units are activated in a turn
+// under two activation orders.
+type ActivationComparison struct {
+	Orders [2]ActivationOrder
+	// Counts[k][n] is the number of unit-turns in which a unit alive at the
+	// start of the turn was activated n times (the last bin is n >= 3)
+	Counts    [2][activationBins]int
+	ChiSquare float64
+	DF        int
+	PValue    float64
+}
+
+// ActivationTest runs the given number of battles under each of two
+// activation orders, using the same per-run seeds for both, and tests
+// whether the per-turn activation counts of the units follow the same
+// distribution with a chi-squared test of homogeneity. Random activation
+// samples units with replacement, so some units act several times in a
+// turn and others not at all; uniform activation gives every unit exactly
+// one activation unless it is killed first.
+func ActivationTest(p Parameters, a, b ActivationOrder, runs int, seed int64) ActivationComparison {
+	cmp := ActivationComparison{Orders: [2]ActivationOrder{a, b}}
+	for k, order := range cmp.Orders {
+		p.ActivationOrder = order
+		for i := 1; i <= runs; i++ {
+			battle := NewBattle(p, rand.New(rand.NewSource(RunSeed(seed, i))))
+			battle.counter = newActivationCounter(battle)
+			battle.Run()
+			for n, c := range battle.counter.hist {
+				cmp.Counts[k][n] += c
+			}
+		}
+	}
+
+	cmp.ChiSquare, cmp.DF, cmp.PValue = homogeneity([][]int{cmp.Counts[0][:], cmp.Counts[1][:]})
+	return cmp
+}
+
+// RepresentationComparison compares battles fought with killed units
+// removed from their force against the same battles fought with killed
+// units kept in place and marked dead.
+type RepresentationComparison struct {
+	Runs int
+	// Outcomes[k][o] counts the runs ending in outcome o, for the removing
+	// (k = 0) and the tracking (k = 1) representations
+	Outcomes [2][Stalled + 1]int
+	// Runs whose results, including the survivors of every turn, are
+	// identical
+	Identical int
+	// Mean turns and survivors of each representation
+	Turns, RedForces, BlueForces [2]float64
+
+	// chi-squared test of homogeneity on the outcome counts
+	ChiSquare float64
+	DF        int
+	PValue    float64
+	// Welch's t-tests on the mean turns and survivors
+	TurnsT, TurnsP           float64
+	RedForcesT, RedForcesP   float64
+	BlueForcesT, BlueForcesP float64
+}
+
+// CompareRepresentations runs the given number of battles with and without
+// TrackDead, using the same per-run seeds for both, and tests whether the
+// two representations differ in their outcomes, durations or survivors.
+// Since tracking dead units changes only how the living are stored, not the
+// order in which they are drawn, every run should be identical.
+func CompareRepresentations(p Parameters, runs int, seed int64) RepresentationComparison {
+	cmp := RepresentationComparison{Runs: runs}
+	var turns, red, blue [2][]float64
+	for i := 1; i <= runs; i++ {
+		var res [2]Result
+		for k := range res {
+			p.TrackDead = k == 1
+			res[k] = NewBattle(p, rand.New(rand.NewSource(RunSeed(seed, i)))).Run()
+			cmp.Outcomes[k][res[k].Outcome]++
+			turns[k] = append(turns[k], float64(res[k].Turns))
+			red[k] = append(red[k], float64(res[k].RedForces))
+			blue[k] = append(blue[k], float64(res[k].BlueForces))
+		}
+		if reflect.DeepEqual(withoutCasualties(res[0]), withoutCasualties(res[1])) {
+			cmp.Identical++
+		}
+	}
+	for k := range turns {
+		cmp.Turns[k], _ = meanVar(turns[k])
+		cmp.RedForces[k], _ = meanVar(red[k])
+		cmp.BlueForces[k], _ = meanVar(blue[k])
+	}
+	cmp.ChiSquare, cmp.DF, cmp.PValue = homogeneity([][]int{cmp.Outcomes[0][:], cmp.Outcomes[1][:]})
+	cmp.TurnsT, cmp.TurnsP = welch(turns[0], turns[1])
+	cmp.RedForcesT, cmp.RedForcesP = welch(red[0], red[1])
+	cmp.BlueForcesT, cmp.BlueForcesP = welch(blue[0], blue[1])
+	return cmp
+}
+
+// withoutCasualties strips the casualty lists from a result, since they
+// hold positions in one representation and ids in the other.
+func withoutCasualties(r Result) Result {
+	h := make([]Turn, len(r.History))
+	for i, t := range r.History {
+		t.RedKilled, t.BlueKilled, t.Killed = nil, nil, nil
+		h[i] = t
+	}
+	r.History = h
+	return r
+}
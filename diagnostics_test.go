@@ -0,0 +1,58 @@
+package lanchester
+
+import "testing"
+
+// a small battle that lasts a good many turns with both forces shooting
+var diagnosticParams = Parameters{
+	RedSize:      20,
+	RedHealth:    1,
+	RedShotProb:  0.01,
+	RedMaxShots:  2,
+	BlueSize:     15,
+	BlueHealth:   1,
+	BlueShotProb: 0.01,
+	BlueMaxShots: 3,
+}
+
+func TestActivationTest(t *testing.T) {
+	cmp := ActivationTest(diagnosticParams, RandomAsynchronous, UniformAsynchronous, 200, 1)
+
+	// uniform activation gives each unit alive at the start of a turn
+	// exactly one activation unless it is killed first
+	uniform := cmp.Counts[1]
+	if uniform[2] != 0 || uniform[3] != 0 {
+		t.Errorf("uniform-asynchronous activated units more than once a turn: %v", uniform)
+	}
+	if uniform[0] >= uniform[1]/10 {
+		t.Errorf("uniform-asynchronous left too many units unactivated: %v", uniform)
+	}
+	// random activation samples with replacement, so about 37% of the units
+	// do not act in a turn, 37% once and 26% more often
+	random := cmp.Counts[0]
+	var total int
+	for _, c := range random {
+		total += c
+	}
+	for n, want := range []float64{0.368, 0.368, 0.184, 0.080} {
+		if got := float64(random[n]) / float64(total); got < want-0.03 || got > want+0.03 {
+			t.Errorf("random-asynchronous activated %v%% of the units %v times, want about %v%%", 100*got, n, 100*want)
+		}
+	}
+	if cmp.PValue > 1e-6 {
+		t.Errorf("activation orders not told apart: chi-squared = %v, p = %v", cmp.ChiSquare, cmp.PValue)
+	}
+}
+
+func TestCompareRepresentations(t *testing.T) {
+	for _, order := range []ActivationOrder{RandomSynchronous, UniformSynchronous, RandomAsynchronous, UniformAsynchronous, ContinuousTime} {
+		p := diagnosticParams
+		p.ActivationOrder = order
+		cmp := CompareRepresentations(p, 100, 1)
+		if cmp.Identical != cmp.Runs {
+			t.Errorf("%v: %v of %v runs identical with and without tracking the dead", order, cmp.Identical, cmp.Runs)
+		}
+		if cmp.Outcomes[0] != cmp.Outcomes[1] {
+			t.Errorf("%v: outcomes %v removing the dead, %v tracking them", order, cmp.Outcomes[0], cmp.Outcomes[1])
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package lanchester
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxExactStates bounds the size of the state space SolveExact will build.
+const maxExactStates = 20000000
+
+// ExactResult holds the exact outcome probabilities of a battle and its
+// expected length in turns.
+type ExactResult struct {
+	RedVictory  float64
+	BlueVictory float64
+	Tie         float64
+	Turns       float64
+}
+
+// SolveExact computes the outcome probabilities and expected duration of a
+// battle exactly, from the Markov chain on (red survivors, blue survivors)
+// implied by the model. It is limited to forces of identical units with a
+// health of 1 using sequential targeting, where a volley of m shots at n
+// targets kills Binomial(min(m, n), p) of them, in battles without a turn
+// limit (a negative MaxTurns).
+//
+// For the synchronous activation orders the chain steps once per turn. For
+// random-asynchronous activation it steps once per activation, and the state
+// also tracks the position within the current turn so that turns can be
+// counted. Uniform-asynchronous activation depends on which units have
+// already acted this turn and has no exact solution on this state space.
+func SolveExact(p Parameters) (ExactResult, error) {
+	redTypes, blueTypes := p.Forces()
+	if len(redTypes) != 1 || len(blueTypes) != 1 {
+		return ExactResult{}, errors.New("exact solution needs a single unit type per force")
+	}
+	red, blue := redTypes[0], blueTypes[0]
+	if red.Health != 1 || blue.Health != 1 {
+		return ExactResult{}, errors.New("exact solution needs units with a health of 1")
+	}
+	if p.RedTargeting != Sequential || p.BlueTargeting != Sequential {
+		return ExactResult{}, errors.New("exact solution needs sequential targeting")
+	}
+	if p.Grid != nil {
+		return ExactResult{}, errors.New("exact solution does not support the grid")
+	}
+	if len(p.Sides) > 0 {
+		return ExactResult{}, errors.New("exact solution covers red and blue only, not named sides")
+	}
+	if len(p.RedReinforcements) > 0 || len(p.BlueReinforcements) > 0 {
+		return ExactResult{}, errors.New("exact solution does not support reinforcements")
+	}
+	if red.Ammo > 0 || blue.Ammo > 0 {
+		return ExactResult{}, errors.New("exact solution needs unlimited ammunition")
+	}
+	if p.RedMorale != (Morale{}) || p.BlueMorale != (Morale{}) {
+		return ExactResult{}, errors.New("exact solution does not support morale")
+	}
+	// the chain has no clock, so even the default limit is out of reach
+	if p.MaxTurns >= 0 || p.StallTurns > 0 {
+		return ExactResult{}, errors.New("exact solution does not support turn limits; set MaxTurns to -1")
+	}
+	e := exactChain{
+		redSize:  red.Count,
+		blueSize: blue.Count,
+		red:      red,
+		blue:     blue,
+		redBreak: float64(red.Count) * p.RedRetreatThreshold,
+		blueBrk:  float64(blue.Count) * p.BlueRetreatThreshold,
+	}
+
+	var v exactValue
+	var err error
+	switch p.ActivationOrder {
+	case RandomSynchronous, UniformSynchronous:
+		v, err = e.solveSync(p.ActivationOrder == RandomSynchronous)
+	case RandomAsynchronous:
+		v, err = e.solveAsync()
+	default:
+		err = fmt.Errorf("no exact solution for %v activation", p.ActivationOrder)
+	}
+	if err != nil {
+		return ExactResult{}, err
+	}
+	// the first turn is always fought
+	return ExactResult{RedVictory: v[0], BlueVictory: v[1], Tie: v[2], Turns: 1 + v[3]}, nil
+}
+
+// exactValue holds, for one state, the probabilities of a red victory, a
+// blue victory and a tie, and the expected number of turns still to start.
+type exactValue [4]float64
+
+func (v exactValue) add(w exactValue, p float64) exactValue {
+	for i := range v {
+		v[i] += p * w[i]
+	}
+	return v
+}
+
+type exactChain struct {
+	redSize, blueSize int
+	red, blue         UnitType
+	redBreak, blueBrk float64
+}
+
+// Mirrors Battle.adjudicate
+func (e *exactChain) adjudicate(r, b int) Outcome {
+	if float64(r) <= e.redBreak && float64(b) <= e.blueBrk {
+		return Tie
+	} else if float64(r) <= e.redBreak {
+		return BlueVictory
+	} else if float64(b) <= e.blueBrk {
+		return RedVictory
+	}
+	return Incomplete
+}
+
+// terminal is the value of a state in which the battle has ended.
+func terminal(o Outcome) exactValue {
+	var v exactValue
+	switch o {
+	case RedVictory:
+		v[0] = 1
+	case BlueVictory:
+		v[1] = 1
+	case Tie:
+		v[2] = 1
+	}
+	return v
+}
+
+// binomial returns the Binomial(n, p) probability mass function.
+func binomial(n int, p float64) []float64 {
+	pmf := make([]float64, n+1)
+	if p <= 0 {
+		pmf[0] = 1
+		return pmf
+	} else if p >= 1 {
+		pmf[n] = 1
+		return pmf
+	}
+	for k := 0; k <= n; k++ {
+		lc, _ := math.Lgamma(float64(n + 1))
+		a, _ := math.Lgamma(float64(k + 1))
+		b, _ := math.Lgamma(float64(n - k + 1))
+		pmf[k] = math.Exp(lc - a - b + float64(k)*math.Log(p) + float64(n-k)*math.Log1p(-p))
+	}
+	return pmf
+}
+
+// solveSync solves the chain that steps once per turn. In a turn, k red
+// and n-k blue units activate (k = r for uniform activation, Binomial(n,
+// r/n) for random activation), and every one of them fires at the same
+// leading units of the enemy, since the dead are only removed at the end of
+// the turn.
+func (e *exactChain) solveSync(random bool) (exactValue, error) {
+	R, B := e.redSize, e.blueSize
+	val := make([][]exactValue, R+1)
+	for r := range val {
+		val[r] = make([]exactValue, B+1)
+	}
+	// the value of arriving at (r, b) at the end of a turn
+	next := func(r, b int) exactValue {
+		if o := e.adjudicate(r, b); o != Incomplete {
+			return terminal(o)
+		}
+		v := val[r][b]
+		v[3]++
+		return v
+	}
+	for n := 0; n <= R+B; n++ {
+		for r := 0; r <= R && r <= n; r++ {
+			b := n - r
+			if b > B {
+				continue
+			}
+			var acts []float64
+			if random {
+				acts = binomial(n, float64(r)/math.Max(1, float64(n)))
+			} else {
+				acts = make([]float64, n+1)
+				acts[r] = 1
+			}
+			// probability of each (red killed, blue killed) pair
+			mr, mb := minInt(e.red.MaxShots, b), minInt(e.blue.MaxShots, r)
+			trans := make([][]float64, mb+1)
+			for i := range trans {
+				trans[i] = make([]float64, mr+1)
+			}
+			for k, pk := range acts {
+				if pk == 0 {
+					continue
+				}
+				blueKilled := binomial(mr, 1-math.Pow(1-e.red.ShotProb, float64(k)))
+				redKilled := binomial(mb, 1-math.Pow(1-e.blue.ShotProb, float64(n-k)))
+				for dr, pr := range redKilled {
+					for db, pb := range blueKilled {
+						trans[dr][db] += pk * pr * pb
+					}
+				}
+			}
+			stay := trans[0][0]
+			var c exactValue
+			for dr := range trans {
+				for db, pt := range trans[dr] {
+					if (dr > 0 || db > 0) && pt > 0 {
+						c = c.add(next(r-dr, b-db), pt)
+					}
+				}
+			}
+			if o := e.adjudicate(r, b); o != Incomplete {
+				// only the starting state can already be decided
+				val[r][b] = c.add(terminal(o), stay)
+				continue
+			}
+			if stay >= 1 {
+				if r == R && b == B {
+					return exactValue{}, errors.New("neither force can inflict casualties; the battle never ends")
+				}
+				continue
+			}
+			// v = stay*(v + one turn) + c
+			c[3] += stay
+			for i := range c {
+				c[i] /= 1 - stay
+			}
+			val[r][b] = c
+		}
+	}
+	return val[R][B], nil
+}
+
+// solveAsync solves the chain that steps once per activation. The state
+// (r, b, i) is about to make the i-th activation of the current turn; the
+// turn ends once i reaches the number of living units.
+func (e *exactChain) solveAsync() (exactValue, error) {
+	R, B := e.redSize, e.blueSize
+	if (R+1)*(B+1)*(R+B) > maxExactStates {
+		return exactValue{}, errors.New("forces are too large for an exact solution")
+	}
+	val := make([][][]exactValue, R+1)
+	for r := range val {
+		val[r] = make([][]exactValue, B+1)
+	}
+	// the value of arriving at (r, b) after the i-th activation
+	next := func(r, b, i int) exactValue {
+		if o := e.adjudicate(r, b); o != Incomplete {
+			return terminal(o)
+		}
+		if i+1 < r+b {
+			return val[r][b][i+1]
+		}
+		v := val[r][b][0]
+		v[3]++
+		return v
+	}
+	for n := 1; n <= R+B; n++ {
+		for r := 0; r <= R && r <= n; r++ {
+			b := n - r
+			if b > B {
+				continue
+			}
+			fr, fb := float64(r)/float64(n), float64(b)/float64(n)
+			blueKilled := binomial(minInt(e.red.MaxShots, b), e.red.ShotProb)
+			redKilled := binomial(minInt(e.blue.MaxShots, r), e.blue.ShotProb)
+			stay := 0.0
+			if r > 0 {
+				stay += fr * blueKilled[0]
+			}
+			if b > 0 {
+				stay += fb * redKilled[0]
+			}
+			// c[i] is the value contributed by the activations that kill
+			c := make([]exactValue, n)
+			for i := 0; i < n; i++ {
+				if r > 0 {
+					for db, pk := range blueKilled[1:] {
+						c[i] = c[i].add(next(r, b-db-1, i), fr*pk)
+					}
+				}
+				if b > 0 {
+					for dr, pk := range redKilled[1:] {
+						c[i] = c[i].add(next(r-dr-1, b, i), fb*pk)
+					}
+				}
+			}
+
+			v := make([]exactValue, n)
+			val[r][b] = v
+			if o := e.adjudicate(r, b); o != Incomplete {
+				// only the starting state can already be decided
+				for i := range v {
+					v[i] = c[i].add(terminal(o), stay)
+				}
+				continue
+			}
+			if stay >= 1 {
+				if r == R && b == B {
+					return exactValue{}, errors.New("neither force can inflict casualties; the battle never ends")
+				}
+				continue
+			}
+			// Activations without casualties cycle through i = 0..n-1 and
+			// back to 0, starting a new turn. Unroll the cycle to find v[0]:
+			// v[0] = sum(stay^i c[i]) + stay^n (one turn + v[0])
+			var sum exactValue
+			w := 1.0
+			for i := 0; i < n; i++ {
+				sum = sum.add(c[i], w)
+				w *= stay
+			}
+			sum[3] += w
+			for k := range sum {
+				sum[k] /= 1 - w
+			}
+			v[0] = sum
+			wrap := v[0]
+			wrap[3]++
+			v[n-1] = c[n-1].add(wrap, stay)
+			for i := n - 2; i > 0; i-- {
+				v[i] = c[i].add(v[i+1], stay)
+			}
+		}
+	}
+	return val[R][B][0], nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
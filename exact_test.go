@@ -0,0 +1,75 @@
+package lanchester
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestSolveExact checks the exact outcome probabilities and expected length
+// of a battle against those of many simulated ones.
+func TestSolveExact(t *testing.T) {
+	const runs = 4000
+	for _, order := range []ActivationOrder{RandomSynchronous, UniformSynchronous, RandomAsynchronous} {
+		p := Parameters{
+			ActivationOrder: order,
+			RedSize:         6,
+			RedHealth:       1,
+			RedShotProb:     0.2,
+			RedMaxShots:     2,
+			BlueSize:        5,
+			BlueHealth:      1,
+			BlueShotProb:    0.3,
+			BlueMaxShots:    2,
+			MaxTurns:        -1,
+		}
+		want, err := SolveExact(p)
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		if sum := want.RedVictory + want.BlueVictory + want.Tie; math.Abs(sum-1) > 1e-9 {
+			t.Errorf("%v: outcome probabilities sum to %v", order, sum)
+		}
+
+		var outcomes [Stalled + 1]int
+		var turns float64
+		for i := 1; i <= runs; i++ {
+			res := NewBattle(p, rand.New(rand.NewSource(RunSeed(1, i)))).Run()
+			outcomes[res.Outcome]++
+			turns += float64(res.Turns)
+		}
+		// the simulated proportions within four standard errors of the exact ones
+		for _, c := range []struct {
+			outcome Outcome
+			p       float64
+		}{{RedVictory, want.RedVictory}, {BlueVictory, want.BlueVictory}, {Tie, want.Tie}} {
+			got := float64(outcomes[c.outcome]) / runs
+			if se := math.Sqrt(c.p * (1 - c.p) / runs); math.Abs(got-c.p) > 4*se+1e-3 {
+				t.Errorf("%v: %v in %.4f of runs, exact probability %.4f", order, c.outcome, got, c.p)
+			}
+		}
+		if got := turns / runs; math.Abs(got-want.Turns) > 0.05*want.Turns {
+			t.Errorf("%v: %.3f turns on average, exact expectation %.3f", order, got, want.Turns)
+		}
+	}
+}
+
+func TestSolveExactUnsupported(t *testing.T) {
+	p := Parameters{RedSize: 2, RedHealth: 2, RedShotProb: 0.5, RedMaxShots: 1, BlueSize: 2, BlueHealth: 1, BlueShotProb: 0.5, BlueMaxShots: 1, MaxTurns: -1}
+	if _, err := SolveExact(p); err == nil {
+		t.Error("solved a battle with a health of 2")
+	}
+	p.RedHealth = 1
+	p.ActivationOrder = UniformAsynchronous
+	if _, err := SolveExact(p); err == nil {
+		t.Error("solved a battle with uniform-asynchronous activation")
+	}
+	// a battle is limited to DefaultMaxTurns unless MaxTurns is negative
+	p.ActivationOrder = RandomSynchronous
+	for _, limit := range []int{0, 100} {
+		p.MaxTurns = limit
+		if _, err := SolveExact(p); err == nil {
+			t.Errorf("solved a battle with a MaxTurns of %v", limit)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package lanchester
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Job is one battle of a batch, numbered in run order. Point is its row of
+// the design of a screening or sensitivity analysis batch.
+type Job struct {
+	Num    int
+	Point  int
+	Params Parameters
+	Seed   int64
+	Result Result
+
+	// Analytic holds the predictions of each of Settings.AnalyticLaws.
+	Analytic []Trajectory
+
+	// Log holds the battle's verbose output when Settings.Verbose is set.
+	Log string
+}
+
+// RunSeed derives the seed of run number run from the master seed, so that
+// any run can be reproduced on its own.
+func RunSeed(master int64, run int) int64 {
+	// splitmix64 finalizer
+	z := uint64(master) + uint64(run)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// Execute runs every battle of the batch on set.Workers goroutines (all
+// CPUs if zero) and calls fn with each finished job in run order. The batch
+// is enumerated with a generator seeded from set.Seed, and every battle gets
+// its own generator seeded by RunSeed, so the results depend only on the
+// master seed and not on the number of workers.
+// Execute stops at the first error returned by fn: no battle starts after
+// it, and the battles already running are waited for but not reported.
+func (set *Settings) Execute(fn func(Job) error) error {
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewSource(set.Seed))
+	workers := set.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan Job)
+	results := make(chan Job)
+	// window bounds the number of jobs in flight, and so the number of
+	// finished jobs waiting for an earlier, slower one
+	window := make(chan struct{}, 4*workers)
+	done := make(chan struct{})
+
+	point := set.designPoint()
+	var genErr error
+	go func() {
+		defer close(jobs)
+		num := 1
+		genErr = set.Each(rng, func(p Parameters) {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case jobs <- Job{Num: num, Point: point(num), Params: p, Seed: RunSeed(set.Seed, num)}:
+			case <-done:
+				return
+			}
+			num++
+		})
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				// once fn has failed, the jobs still coming are dropped
+				// unstarted
+				select {
+				case <-done:
+					continue
+				default:
+				}
+				set.runJob(&j)
+				results <- j
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]Job)
+	next := 1
+	var err error
+	for j := range results {
+		pending[j.Num] = j
+		for {
+			j, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if err == nil {
+				if err = fn(j); err != nil {
+					close(done)
+				}
+			}
+			<-window
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return genErr
+}
+
+// designPoint returns the function that gives the row of the design to
+// which each run number belongs, in the batch modes with a design: every
+// row is run Niter times, or Replicates times in a sensitivity analysis,
+// and a screening design over again for each activation order.
+func (set *Settings) designPoint() func(num int) int {
+	switch set.BatchMode {
+	case FractionalFactorial, PlackettBurman:
+		if d, err := set.Screening(); err == nil {
+			return func(num int) int { return (num - 1) / set.Niter % len(d.Runs) }
+		}
+	case SobolIndices, Morris:
+		replicates := set.Replicates
+		if replicates < 1 {
+			replicates = 1
+		}
+		return func(num int) int { return (num - 1) / replicates }
+	}
+	return func(int) int { return 0 }
+}
+
+// startHook, if set, is called as each battle of Execute starts, so that
+// the tests can see which do.
+var startHook func(Job)
+
+// runJob fights a single battle with its own generator.
+func (set *Settings) runJob(j *Job) {
+	if startHook != nil {
+		startHook(*j)
+	}
+	b := NewBattle(j.Params, rand.New(rand.NewSource(j.Seed)))
+	var buf bytes.Buffer
+	if set.Verbose {
+		b.Log = &buf
+	}
+	j.Result = b.Run()
+	for _, law := range set.AnalyticLaws {
+		tr := Solve(j.Params, law, set.HelmboldW)
+		j.Analytic = append(j.Analytic, tr)
+		if set.Verbose {
+			fmt.Fprintf(&buf, "The %v law predicts %v after %.2f turns, with %.1f red and %.1f blue units left.\n",
+				law, tr.Outcome, tr.Duration, tr.Red[len(tr.Red)-1], tr.Blue[len(tr.Blue)-1])
+		}
+	}
+	j.Log = buf.String()
+}
@@ -0,0 +1,88 @@
+package lanchester
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// executorSettings is a Monte Carlo batch of small battles.
+func executorSettings(workers int) *Settings {
+	return &Settings{
+		BatchMode:       MonteCarlo,
+		Niter:           200,
+		Workers:         workers,
+		Seed:            7,
+		ActivationOrder: []ActivationOrder{RandomSynchronous, UniformSynchronous, RandomAsynchronous, UniformAsynchronous, ContinuousTime},
+		RedSize:         [3]int{5, 15, 0},
+		RedHealth:       [3]int{1, 2, 0},
+		RedShotProb:     [3]float64{0.05, 0.3, 0},
+		RedMaxShots:     [3]int{1, 3, 0},
+		BlueSize:        [3]int{5, 15, 0},
+		BlueHealth:      [3]int{1, 2, 0},
+		BlueShotProb:    [3]float64{0.05, 0.3, 0},
+		BlueMaxShots:    [3]int{1, 3, 0},
+	}
+}
+
+func TestExecuteWorkers(t *testing.T) {
+	var want []byte
+	for _, workers := range []int{1, 2, 8} {
+		set := executorSettings(workers)
+		set.WriteDynamics = true
+		got := execute(t, set)
+		if want == nil {
+			want = got
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%v workers wrote different output from 1", workers)
+		}
+	}
+}
+
+func TestExecuteStops(t *testing.T) {
+	fail := errors.New("cannot write")
+	for _, workers := range []int{1, 4} {
+		var mu sync.Mutex
+		var started, late []int
+		failed := false
+		startHook = func(j Job) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failed {
+				late = append(late, j.Num)
+			}
+			started = append(started, j.Num)
+		}
+
+		set := executorSettings(workers)
+		set.Niter = 100000
+		reported := 0
+		err := set.Execute(func(j Job) error {
+			if reported++; j.Num != reported {
+				t.Errorf("%v workers: run %v reported as number %v", workers, j.Num, reported)
+			}
+			if j.Num == 10 {
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+				return fail
+			}
+			return nil
+		})
+		startHook = nil
+		if err != fail {
+			t.Errorf("%v workers: got error %v, want %v", workers, err, fail)
+		}
+		if reported != 10 {
+			t.Errorf("%v workers: %v runs reported, want 10", workers, reported)
+		}
+		if len(late) > 0 {
+			t.Errorf("%v workers: runs %v started after the callback failed", workers, late)
+		}
+		// only the runs in the window can have started
+		if max := 10 + 4*workers; len(started) > max {
+			t.Errorf("%v workers: %v runs started, want at most %v", workers, len(started), max)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/sdmccabe/lanchester
+
+go 1.17
@@ -0,0 +1,314 @@
+package lanchester
+
+import (
+	"fmt"
+	"math"
+)
+
+// Movement selects how a force's units move on the grid at the end of each
+// turn.
+type Movement int
+
+const (
+	// Close with the nearest enemy until it is within range
+	Advance Movement = iota
+	// Stay put
+	Hold
+	// Fall back toward the force's own edge
+	Withdraw
+)
+
+func (m Movement) String() string {
+	switch m {
+	case Advance:
+		return "advance"
+	case Hold:
+		return "hold"
+	case Withdraw:
+		return "withdraw"
+	}
+	return "undefined"
+}
+
+// ParseMovement is the inverse of Movement.String.
+func ParseMovement(s string) (Movement, error) {
+	for m := Advance; m <= Withdraw; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown movement %q", s)
+}
+
+// MarshalText lets movements be written by name in JSON.
+func (m Movement) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText reads a movement by name.
+func (m *Movement) UnmarshalText(text []byte) error {
+	x, err := ParseMovement(string(text))
+	if err != nil {
+		return err
+	}
+	*m = x
+	return nil
+}
+
+// Edge is a side of the grid along which a force deploys.
+type Edge int
+
+const (
+	Left Edge = iota
+	Right
+	Top
+	Bottom
+)
+
+func (e Edge) String() string {
+	switch e {
+	case Left:
+		return "left"
+	case Right:
+		return "right"
+	case Top:
+		return "top"
+	case Bottom:
+		return "bottom"
+	}
+	return "undefined"
+}
+
+// ParseEdge is the inverse of Edge.String.
+func ParseEdge(s string) (Edge, error) {
+	for e := Left; e <= Bottom; e++ {
+		if e.String() == s {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown edge %q", s)
+}
+
+// MarshalText lets edges be written by name in JSON.
+func (e Edge) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText reads an edge by name.
+func (e *Edge) UnmarshalText(text []byte) error {
+	x, err := ParseEdge(string(text))
+	if err != nil {
+		return err
+	}
+	*e = x
+	return nil
+}
+
+// Direction of the edge from the middle of the grid
+func (e Edge) direction() (dx, dy int) {
+	switch e {
+	case Right:
+		return 1, 0
+	case Top:
+		return 0, -1
+	case Bottom:
+		return 0, 1
+	}
+	return -1, 0
+}
+
+// Grid is a two-dimensional battlefield of Width x Height cells. Red
+// deploys along the left edge and blue along the right; in a battle between
+// named sides, each side's deployment gives its edge. Terrain, if set,
+// is loaded from TerrainFile by LoadTerrain; without it the grid is open
+// ground.
+type Grid struct {
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	Red         Deployment `json:"red"`
+	Blue        Deployment `json:"blue"`
+	TerrainFile string     `json:"terrain"`
+	Terrain     *Terrain   `json:"-"`
+}
+
+// Deployment describes how one force is placed on the grid, how it moves
+// and how far its weapons reach.
+//
+// Units start in random cells within Depth rows or columns of their own
+// edge (the left edge by default, with y increasing toward the bottom). At
+// the end of every turn each unit moves up to Speed cells of open ground,
+// one step to any of the eight neighbouring cells at a time: advancing
+// units head for the nearest enemy and withdrawing units straight back to
+// their own edge. A unit that cannot afford the next step into rough
+// ground saves its movement for the following turn. Units can only fire
+// at enemies within Range cells, measured between cell centres; a Range of
+// 0 is unlimited. The kill probability falls off linearly with distance,
+// from the unit's shot probability at point-blank range to (1 - Falloff)
+// times it at the limit of its range.
+type Deployment struct {
+	Depth    int      `json:"depth"`
+	Movement Movement `json:"movement"`
+	Speed    int      `json:"speed"`
+	Range    float64  `json:"range"`
+	Falloff  float64  `json:"falloff"`
+	Edge     Edge     `json:"edge"`
+}
+
+// Place the units of each force at random within their deployment zones.
+func (b *Battle) deploy() {
+	for k := range b.forces {
+		f := &b.forces[k]
+		for i := range f.forces {
+			b.place(f, &f.forces[i])
+		}
+	}
+}
+
+// Place a unit at random within its force's deployment zone.
+func (b *Battle) place(f *force, u *unit) {
+	g := b.Grid
+	dx, dy := f.deployment.Edge.direction()
+	// distance of the far side of the zone from the edge
+	extent := g.Width
+	if dy != 0 {
+		extent = g.Height
+	}
+	depth := f.deployment.Depth
+	if depth < 1 {
+		depth = 1
+	}
+	if depth > extent {
+		depth = extent
+	}
+	if dx != 0 {
+		u.x, u.y = b.rng.Intn(depth), b.rng.Intn(g.Height)
+		if dx > 0 {
+			u.x = g.Width - 1 - u.x
+		}
+	} else {
+		u.y, u.x = b.rng.Intn(depth), b.rng.Intn(g.Width)
+		if dy > 0 {
+			u.y = g.Height - 1 - u.y
+		}
+	}
+}
+
+func distance(a, b unit) float64 {
+	return math.Hypot(float64(a.x-b.x), float64(a.y-b.y))
+}
+
+// Whether a target at distance dist is within range
+func (d Deployment) reaches(dist float64) bool {
+	return d.Range <= 0 || dist <= d.Range
+}
+
+// Kill probability of a unit's shot at a target at distance dist
+func (d Deployment) killProb(a unit, dist float64) float64 {
+	if d.Range <= 0 {
+		return a.shotProb
+	}
+	return a.shotProb * (1 - d.Falloff*dist/d.Range)
+}
+
+// manoeuvre moves every living unit according to its force's movement. It
+// reports whether the battle can go on: whether any unit moved or has an
+// enemy within range. Without a grid every enemy is always within range.
+func (b *Battle) manoeuvre() bool {
+	if b.Grid == nil {
+		return true
+	}
+	active := false
+	for i := range b.forces {
+		f := &b.forces[i]
+		if !f.routed && f.move(b.enemies(f), b.Grid) {
+			active = true
+		}
+	}
+	return active
+}
+
+// Move the living units of f with respect to the enemy. Report whether any
+// unit moved or has an enemy within range.
+func (f *force) move(enemies []*force, g *Grid) bool {
+	active := false
+	for i := 0; i < f.size(); i++ {
+		u := &f.forces[f.index(i)]
+		budget := u.moves + float64(f.deployment.Speed)
+		u.moves = 0
+		for {
+			e, dist, ok := nearest(enemies, *u)
+			if !ok {
+				return active
+			}
+			inRange := f.deployment.reaches(dist)
+			active = active || inRange
+			if f.deployment.Movement == Hold || f.deployment.Movement == Advance && inRange {
+				break
+			}
+			dx, dy := sign(e.x-u.x), sign(e.y-u.y)
+			if f.deployment.Movement == Withdraw {
+				dx, dy = f.deployment.Edge.direction()
+			}
+			// go straight if the terrain allows it, otherwise try either
+			// half of a diagonal step
+			moved, waiting := false, false
+			for _, d := range [][2]int{{dx, dy}, {dx, 0}, {0, dy}} {
+				x, y := clamp(u.x+d[0], g.Width), clamp(u.y+d[1], g.Height)
+				if x == u.x && y == u.y {
+					continue
+				}
+				if c := g.Terrain.cost(x, y); c <= budget {
+					budget -= c
+					u.x, u.y = x, y
+					moved = true
+					break
+				} else if f.deployment.Speed > 0 && !math.IsInf(c, 1) {
+					waiting = true
+				}
+			}
+			if !moved {
+				if waiting {
+					// save up for the step into rough ground, which the
+					// unit will be able to afford in time
+					u.moves = budget
+					active = true
+				}
+				break
+			}
+			active = true
+		}
+	}
+	return active
+}
+
+// The living enemy nearest to u and its distance, if there are any
+func nearest(enemies []*force, u unit) (unit, float64, bool) {
+	var best unit
+	bestDist, ok := math.Inf(1), false
+	for _, f := range enemies {
+		for i := 0; i < f.size(); i++ {
+			if d := distance(u, f.living(i)); d < bestDist {
+				best, bestDist, ok = f.living(i), d, true
+			}
+		}
+	}
+	return best, bestDist, ok
+}
+
+func sign(x int) int {
+	if x > 0 {
+		return 1
+	} else if x < 0 {
+		return -1
+	}
+	return 0
+}
+
+func clamp(x, n int) int {
+	if x < 0 {
+		return 0
+	} else if x >= n {
+		return n - 1
+	}
+	return x
+}
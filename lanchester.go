@@ -1,82 +1,144 @@
-package main
+// Package lanchester is an agent-based model of Lanchesterian combat.
+//
+// A red and a blue force, each a collection of units of one or more types,
+// take turns shooting at one another until one of them falls below its
+// retreat threshold. A battle may instead be fought between any number of
+// named sides, allied or hostile to each other. A Battle holds all of the
+// state for a single run, so any number of battles may be run side by
+// side.
+package lanchester
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/csv"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"math"
 	"math/rand"
-	"os"
+	"sort"
 	"strings"
 	"time"
 )
 
-var f *os.File
-var w *csv.Writer
-
-//enums
+// enums
 type ActivationOrder int
 type BatchMode int
 type Outcome int
 
 const (
-	incomplete = iota
-	redVictory
-	blueVictory
-	tie
+	Incomplete Outcome = iota
+	RedVictory
+	BlueVictory
+	// No force was left standing, written "stalemate" as it always has been
+	Tie
+	// The standing coalition of a battle between named sides won
+	Victory
+	// Nobody was lost for StallTurns turns in a row
+	Stalled
 )
 const (
-	randomSynchronous = iota
-	uniformSynchronous
-	randomAsynchronous
-	uniformAsynchronous
+	RandomSynchronous ActivationOrder = iota
+	UniformSynchronous
+	RandomAsynchronous
+	UniformAsynchronous
+	ContinuousTime
 )
 
 const (
-	singleRun = iota
-	parameterSweep
-	monteCarlo
-	latinHypercube
+	SingleRun BatchMode = iota
+	ParameterSweep
+	MonteCarlo
+	LatinHypercube
+	Exact
+	FractionalFactorial
+	PlackettBurman
+	SobolSequence
+	HaltonSequence
+	SobolIndices
+	Morris
 )
 
 type unit struct {
 	maxShots int
 	shotProb float64
 	health   int
+	kind     int
+	id       int
+	alive    bool
+	// rounds left, or -1 if ammunition is unlimited
+	ammo int
+	// suppression, and whether the unit has broken and is leaving the fight
+	suppression float64
+	broken      bool
+	// position on the grid, if any, and movement saved from earlier turns
+	x, y  int
+	moves float64
+	// in continuous time, where a unit's shots are spread over many
+	// events, its own targeter and the shots of its volley already fired
+	aim  targeter
+	shot int
 }
 
+// A force holds its units in creation order. Normally killed units are
+// removed from forces; with trackDead they stay in place, marked dead, and
+// live lists the slice indices of the living. Broken units leave the force
+// the same way, and are counted in broken. A force that has fallen to its
+// retreat threshold, or whose morale has given way, is routed and takes no
+// further part in the battle.
 type force struct {
+	name             string
+	side             int
 	forces           []unit
+	live             []int
+	trackDead        bool
 	forceSize        int
 	retreatThreshold float64
-	shotProb         float64
-	maxShots         int
-	health           int
-}
-
-type modelSettings struct {
-	Filename             string            `json:"filename"`
-	WriteDynamics        bool              `json:"writeDynamics"`
-	BatchMode            BatchMode         `json:"batchMode"`
-	Niter                int               `json:"niter"`
-	Verbose              bool              `json:"verbose"`
-	ActivationOrder      []ActivationOrder `json:"activationOrder"`
-	RedSize              [3]int            `json:"RedSize"`
-	RedHealth            [3]int            `json:"RedHealth"`
-	RedShotProb          [3]float64        `json:"RedShotProb"`
-	RedMaxShots          [3]int            `json:"RedMaxShots"`
-	RedRetreatThreshold  [3]float64        `json:"RedRetreatThreshold"`
-	BlueSize             [3]int            `json:"BlueSize"`
-	BlueHealth           [3]int            `json:"BlueHealth"`
-	BlueShotProb         [3]float64        `json:"BlueShotProb"`
-	BlueMaxShots         [3]int            `json:"BlueMaxShots"`
-	BlueRetreatThreshold [3]float64        `json:"BlueRetreatThreshold"`
-}
-
-type parameters struct {
-	Verbose              bool
+	types            []UnitType
+	targeting        targeter
+	policy           Targeting
+	deployment       Deployment
+	reinforcements   reinforcements
+	supply           supply
+	morale           Morale
+	broken           int
+	routed           bool
+}
+
+// UnitType describes one kind of unit within a force, e.g. riflemen or
+// machine guns. Each unit carries Ammo rounds, one per shot; an Ammo of 0
+// is unlimited.
+type UnitType struct {
+	Name     string  `json:"name"`
+	Count    int     `json:"count"`
+	Health   int     `json:"health"`
+	ShotProb float64 `json:"shotProb"`
+	MaxShots int     `json:"maxShots"`
+	Ammo     int     `json:"ammo"`
+}
+
+// DefaultMaxTurns is the turn limit of a battle whose MaxTurns is 0, so that
+// a battle that would otherwise go on for ever still ends.
+const DefaultMaxTurns = 10000
+
+// Parameters fully describe a single run of the model. If RedUnits or
+// BlueUnits is set, that force is built from the listed unit types and its
+// Size, Health, ShotProb and MaxShots parameters are ignored. TrackDead
+// keeps killed units in place, marked dead, rather than removing them. If
+// Grid is set, the battle is fought on a grid, with ranges and movement.
+//
+// If Sides is set, the battle is fought between those sides and all of the
+// red and blue parameters are ignored. Hostility[i][j] tells whether side i
+// fires on side j; without it every side is hostile to every other.
+// RedReinforcements and BlueReinforcements schedule units to join the red
+// and blue forces during the battle. RedAmmo and BlueAmmo give the rounds
+// each unit of a force without unit types carries (0 is unlimited), and
+// RedResupply and BlueResupply the rounds delivered to each force per turn.
+// RedMorale and BlueMorale subject the units of each force to suppression.
+//
+// A battle still going after MaxTurns turns (DefaultMaxTurns if 0, and
+// without limit if negative) is called off as incomplete, and one in which
+// no unit has been killed or broken for StallTurns turns in a row (never
+// if 0) as stalled.
+type Parameters struct {
 	ActivationOrder      ActivationOrder
 	RedSize              int
 	RedHealth            int
@@ -88,20 +150,109 @@ type parameters struct {
 	BlueShotProb         float64
 	BlueMaxShots         int
 	BlueRetreatThreshold float64
+	RedUnits             []UnitType
+	BlueUnits            []UnitType
+	RedTargeting         Targeting
+	BlueTargeting        Targeting
+	RedReinforcements    []Reinforcement
+	BlueReinforcements   []Reinforcement
+	RedAmmo              int
+	BlueAmmo             int
+	RedResupply          float64
+	BlueResupply         float64
+	RedMorale            Morale
+	BlueMorale           Morale
+	MaxTurns             int
+	StallTurns           int
+	TrackDead            bool
+	Grid                 *Grid
+	Sides                []Side
+	Hostility            [][]bool
 }
 
-type casualties []int
+// Casualties lists the units killed in one turn: their positions among the
+// living, or their ids if dead units are tracked.
+type Casualties []int
+
+// Turn records the state of the forces at the end of a turn. Forces,
+// ByType and Killed hold the survivors, the survivors of each unit type and
+// the casualties of every side, Committed the number of units each side has
+// committed to the battle, reinforcements included, Rounds the rounds its
+// living units have left and Broken the number of its units that have
+// broken so far; the Red and Blue fields repeat them for the first two.
+// Time is the simulated time, which equals Turn except in the
+// continuous-time engine, where the final record is made at the moment the
+// battle ended.
+type Turn struct {
+	Turn       int
+	Time       float64
+	RedForces  int
+	BlueForces int
+	RedByType  []int
+	BlueByType []int
+	RedKilled  Casualties
+	BlueKilled Casualties
+	Forces     []int
+	ByType     [][]int
+	Killed     []Casualties
+	Committed  []int
+	Rounds     []int
+	Broken     []int
+}
+
+// Result is the outcome of a completed battle. Victors names the sides
+// left standing at the end.
+type Result struct {
+	Outcome    Outcome
+	RedForces  int
+	BlueForces int
+	RedByType  []int
+	BlueByType []int
+	Forces     []int
+	ByType     [][]int
+	Victors    []string
+	Turns      int
+	Time       float64
+	History    []Turn
+}
+
+// Battle is a single run of the model.
+type Battle struct {
+	Parameters
+
+	// Log, if non-nil, receives a human-readable account of the battle.
+	Log io.Writer
 
-var turns = 0
-var par parameters
-var set modelSettings
-var runNum = 1
-var writeToFile = false
+	rng     *rand.Rand
+	forces  []force
+	hostile [][]bool
+	victors []string
+	turns   int
+	time    float64
+	history []Turn
+	// units lost so far, and turns since the last loss
+	lost  int
+	quiet int
 
-//Implement Stringer
-func (f force) String() string {
-	return fmt.Sprintf("%v units, each with maximum health %v, a %v kill probability, and a retreat threshold of %v",
-		len(f.forces), f.health, f.shotProb, f.retreatThreshold)
+	// if set, tallies activations for ActivationTest
+	counter *activationCounter
+}
+
+// Implement Stringer
+func (f *force) String() string {
+	if len(f.types) == 1 {
+		t := f.types[0]
+		return fmt.Sprintf("%v units, each with maximum health %v, a %v kill probability, and a retreat threshold of %v",
+			f.size(), t.Health, t.ShotProb, f.retreatThreshold)
+	}
+	var buffer bytes.Buffer
+	for i, n := range f.byType() {
+		t := f.types[i]
+		buffer.WriteString(fmt.Sprintf("%v %v units with maximum health %v and a %v kill probability, ",
+			n, t.Name, t.Health, t.ShotProb))
+	}
+	buffer.WriteString(fmt.Sprintf("and a retreat threshold of %v", f.retreatThreshold))
+	return buffer.String()
 }
 
 func (a ActivationOrder) String() string {
@@ -113,11 +264,23 @@ func (a ActivationOrder) String() string {
 		return fmt.Sprintf("random-asynchronous")
 	} else if a == 3 {
 		return fmt.Sprintf("uniform-asynchronous")
+	} else if a == 4 {
+		return fmt.Sprintf("continuous-time")
 	}
 	return "undefined"
 }
 
-func (c casualties) String() string {
+// ParseActivationOrder is the inverse of ActivationOrder.String.
+func ParseActivationOrder(s string) (ActivationOrder, error) {
+	for a := RandomSynchronous; a <= ContinuousTime; a++ {
+		if a.String() == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown activation order %q", s)
+}
+
+func (c Casualties) String() string {
 	var buffer bytes.Buffer
 	for _, x := range c {
 		buffer.WriteString(fmt.Sprintf("%v ", x))
@@ -134,368 +297,733 @@ func (o Outcome) String() string {
 		return fmt.Sprintf("blue-victory")
 	} else if o == 3 {
 		return fmt.Sprintf("stalemate")
+	} else if o == 4 {
+		return fmt.Sprintf("victory")
+	} else if o == 5 {
+		return fmt.Sprintf("stalled")
 	} else {
 		return fmt.Sprintf("error")
 	}
 }
 
-//Initialize and return a force: a collection of units
-func createForce(size, health, maxShots int, shotProb, retreatThreshold float64) force {
-	f := force{forces: make([]unit, 0),
-		forceSize:        size,
+// UnitCount is the total number of units of the given types.
+func UnitCount(types []UnitType) int {
+	n := 0
+	for _, t := range types {
+		n += t.Count
+	}
+	return n
+}
+
+// Forces returns the unit types making up the red and blue forces. A force
+// without explicit unit types is a single type of identical units.
+func (p Parameters) Forces() (red, blue []UnitType) {
+	red, blue = p.RedUnits, p.BlueUnits
+	if len(red) == 0 {
+		red = []UnitType{{Count: p.RedSize, Health: p.RedHealth, ShotProb: p.RedShotProb, MaxShots: p.RedMaxShots, Ammo: p.RedAmmo}}
+	}
+	if len(blue) == 0 {
+		blue = []UnitType{{Count: p.BlueSize, Health: p.BlueHealth, ShotProb: p.BlueShotProb, MaxShots: p.BlueMaxShots, Ammo: p.BlueAmmo}}
+	}
+	return red, blue
+}
+
+// Initialize and return a force: a collection of units of the given types.
+func createForce(name string, types []UnitType, retreatThreshold float64, trackDead bool) force {
+	f := force{name: name,
+		forces:           make([]unit, 0, UnitCount(types)),
+		trackDead:        trackDead,
+		forceSize:        UnitCount(types),
 		retreatThreshold: retreatThreshold,
-		shotProb:         shotProb,
-		health:           health,
-		maxShots:         maxShots}
-	for i := 0; i < size; i++ {
-		f.forces = append(f.forces, unit{maxShots, shotProb, health})
+		types:            types}
+	for k, t := range types {
+		for i := 0; i < t.Count; i++ {
+			if trackDead {
+				f.live = append(f.live, len(f.forces))
+			}
+			f.forces = append(f.forces, newUnit(t, k, len(f.forces)))
+		}
 	}
 	return f
 }
 
-func doCombatRandomSync(red, blue *force, par parameters) bool {
+// A fresh unit of the k-th type of its force
+func newUnit(t UnitType, k, id int) unit {
+	ammo := t.Ammo
+	if ammo == 0 {
+		ammo = -1
+	}
+	return unit{maxShots: t.MaxShots, shotProb: t.ShotProb, health: t.Health, kind: k, id: id, alive: true, ammo: ammo}
+}
+
+// Number of units still in the fight
+func (f *force) size() int {
+	if f.trackDead {
+		return len(f.live)
+	}
+	return len(f.forces)
+}
+
+// Slice index of the i-th unit still in the fight
+func (f *force) index(i int) int {
+	if f.trackDead {
+		return f.live[i]
+	}
+	return i
+}
+
+// The i-th unit still in the fight
+func (f *force) living(i int) unit {
+	return f.forces[f.index(i)]
+}
+
+// Count the surviving units of each type
+func (f *force) byType() []int {
+	n := make([]int, len(f.types))
+	for _, u := range f.forces {
+		if u.alive {
+			n[u.kind]++
+		}
+	}
+	return n
+}
+
+// NewBattle sets up a battle between freshly created forces, one per side.
+// The battle draws all of its random numbers from rng; if rng is nil, a
+// generator seeded from the clock is used. NewBattle panics if the
+// activation order is unknown.
+func NewBattle(p Parameters, rng *rand.Rand) *Battle {
+	if p.ActivationOrder < RandomSynchronous || p.ActivationOrder > ContinuousTime {
+		panic(fmt.Sprintf("lanchester: unknown activation order %v", int(p.ActivationOrder)))
+	}
+	if rng == nil {
+		rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	sides := p.AllSides()
+	b := &Battle{
+		Parameters: p,
+		rng:        rng,
+		forces:     make([]force, len(sides)),
+		hostile:    p.hostility(),
+	}
+	for i, side := range sides {
+		b.forces[i] = createForce(side.Name, side.Units, side.RetreatThreshold, p.TrackDead)
+		b.forces[i].side = i
+		b.forces[i].targeting = newTargeter(side.Targeting)
+		b.forces[i].policy = side.Targeting
+		b.forces[i].deployment = side.Deployment
+		b.forces[i].reinforcements = newReinforcements(side.Reinforcements)
+		b.forces[i].supply.rate = side.Resupply
+		b.forces[i].morale = side.Morale
+	}
+	if p.Grid != nil {
+		b.deploy()
+	}
+	return b
+}
+
+// Run fights the battle to completion using the configured activation order.
+func (b *Battle) Run() Result {
+	if b.Log != nil {
+		fmt.Fprintln(b.Log, "Initial model state:")
+		for i := range b.forces {
+			fmt.Fprintf(b.Log, "The %v force has %v.\n", b.forces[i].name, &b.forces[i])
+		}
+		fmt.Fprintf(b.Log, "Running model with %v activation:\n", b.ActivationOrder)
+	}
+	var status Outcome
+	switch b.ActivationOrder {
+	case RandomSynchronous:
+		status = b.doCombatRandomSync()
+	case UniformSynchronous:
+		status = b.doCombatUniform()
+	case RandomAsynchronous:
+		status = b.doCombatRandomAsync()
+	case UniformAsynchronous:
+		status = b.doCombatUniformAsync()
+	case ContinuousTime:
+		status = b.doCombatContinuous()
+	}
+	if b.Log != nil {
+		if b.ActivationOrder == ContinuousTime {
+			fmt.Fprintf(b.Log, "\nModel finished at time %.3f.\n\n", b.time)
+		} else {
+			fmt.Fprintf(b.Log, "\nModel finished after %v turns.\n\n", b.turns)
+		}
+		fmt.Fprintln(b.Log, "Final model state:")
+		for i := range b.forces {
+			fmt.Fprintf(b.Log, "The %v force %v.\n", b.forces[i].name, &b.forces[i])
+		}
+	}
+	last := b.history[len(b.history)-1]
+	return Result{
+		Outcome:    status,
+		RedForces:  last.RedForces,
+		BlueForces: last.BlueForces,
+		RedByType:  last.RedByType,
+		BlueByType: last.BlueByType,
+		Forces:     last.Forces,
+		ByType:     last.ByType,
+		Victors:    b.victors,
+		Turns:      b.turns,
+		Time:       last.Time,
+		History:    b.history,
+	}
+}
+
+func (b *Battle) doCombatRandomSync() Outcome {
 	for {
 		// increment turn
-		turns++
+		b.turns++
+		b.startTurn(b.turns)
 
-		pool := len(red.forces) + len(blue.forces)
+		pool := b.pool()
 		for i := 0; i < pool; i++ {
-			active := rand.Intn(pool)
-			if active >= len(red.forces) {
-				shoot(blue.forces[active-len(red.forces)], red)
-			} else {
-				shoot(red.forces[active], blue)
-			}
+			f, x := b.pick(b.rng.Intn(pool))
+			b.shoot(f, f.index(x))
 		}
 
 		//remove killed units
-		redKilled, blueKilled := removeKilled(red, blue)
-		if par.Verbose {
-			printCasualties(redKilled, blueKilled)
-		}
-		//adjudicate results
-		if status := adjudicate(red, blue, red.forceSize, blue.forceSize, par); status != incomplete {
-			if writeToFile {
-				writeLine(*red, *blue, status)
-			}
+		killed := b.removeKilled()
+		b.printCasualties(killed)
 
-			return true
+		//adjudicate results
+		status := b.adjudicate()
+		b.record(killed)
+		if status != Incomplete {
+			return status
+		}
+		if status, over := b.callOff(); over {
+			return status
 		}
-		if writeToFile && set.WriteDynamics {
-			writeLine(*red, *blue, incomplete)
+		if !b.manoeuvre() || !b.armed() {
+			return Incomplete
 		}
 	}
-	return false
 }
 
-func doCombatUniform(red, blue *force, par parameters) bool {
+func (b *Battle) doCombatUniform() Outcome {
 	for {
 		// increment turn
-		turns++
+		b.turns++
+		b.startTurn(b.turns)
 
-		turnList := rand.Perm(len(red.forces) + len(blue.forces))
+		turnList := b.rng.Perm(b.pool())
 		for _, e := range turnList {
-			if e >= len(red.forces) {
-				shoot(blue.forces[e-len(red.forces)], red)
-			} else {
-				shoot(red.forces[e], blue)
-			}
-
+			f, x := b.pick(e)
+			b.shoot(f, f.index(x))
 		}
 		//remove killed units
-		redKilled, blueKilled := removeKilled(red, blue)
-		if par.Verbose {
-			printCasualties(redKilled, blueKilled)
-		}
+		killed := b.removeKilled()
+		b.printCasualties(killed)
 
 		//adjudicate results
-		if status := adjudicate(red, blue, red.forceSize, blue.forceSize, par); status != incomplete {
-			if writeToFile {
-				writeLine(*red, *blue, status)
-			}
+		status := b.adjudicate()
+		b.record(killed)
+		if status != Incomplete {
+			return status
+		}
+		if status, over := b.callOff(); over {
+			return status
+		}
+		if !b.manoeuvre() || !b.armed() {
+			return Incomplete
+		}
+	}
+}
 
-			return true
+func (b *Battle) doCombatRandomAsync() Outcome {
+	for {
+		b.turns++
+		turn := make([]Casualties, len(b.forces))
+		b.startTurn(b.turns)
+		for i := 0; i < b.pool(); i++ {
+			f, x := b.pick(b.rng.Intn(b.pool()))
+			b.shoot(f, f.index(x))
+			//remove killed units
+			killed := b.removeKilled()
+			b.printCasualties(killed)
+			addCasualties(turn, killed)
+
+			if status := b.adjudicate(); status != Incomplete {
+				b.record(turn)
+				return status
+			}
+		}
+		b.record(turn)
+		if status, over := b.callOff(); over {
+			return status
 		}
-		if writeToFile && set.WriteDynamics {
-			writeLine(*red, *blue, incomplete)
+		if !b.manoeuvre() || !b.armed() {
+			return Incomplete
 		}
 	}
-	return false
 }
 
-func doCombatRandomAsync(red, blue *force, par parameters) bool {
+func (b *Battle) doCombatUniformAsync() Outcome {
+	type activation struct {
+		f  *force
+		id int
+	}
 	for {
-		turns++
-		for i := 0; i < len(red.forces)+len(blue.forces); i++ {
-			x := rand.Intn(len(red.forces) + len(blue.forces))
-			if x < len(red.forces) {
-				shoot(red.forces[x], blue)
-			} else {
-				shoot(blue.forces[x-len(red.forces)], red)
+		b.turns++
+		turn := make([]Casualties, len(b.forces))
+		b.startTurn(b.turns)
+
+		// every unit alive at the start of the turn activates once, in
+		// random order; units are looked up by id since kills take
+		// effect immediately and shift the slices
+		order := make([]activation, 0, b.pool())
+		for k := range b.forces {
+			f := &b.forces[k]
+			if f.routed {
+				continue
 			}
-			//remove killed units
-			redKilled, blueKilled := removeKilled(red, blue)
-			if par.Verbose {
-				printCasualties(redKilled, blueKilled)
+			for i := 0; i < f.size(); i++ {
+				order = append(order, activation{f, f.living(i).id})
 			}
+		}
+		b.rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
 
-			if status := adjudicate(red, blue, red.forceSize, blue.forceSize, par); status != incomplete {
-				if writeToFile {
-					writeLine(*red, *blue, status)
-				}
+		for _, a := range order {
+			if a.f.routed {
+				continue
+			}
+			x := a.f.find(a.id)
+			if x < 0 {
+				// killed earlier in the turn
+				continue
+			}
+			b.shoot(a.f, x)
+			//remove killed units
+			killed := b.removeKilled()
+			b.printCasualties(killed)
+			addCasualties(turn, killed)
 
-				return true
+			if status := b.adjudicate(); status != Incomplete {
+				b.record(turn)
+				return status
 			}
 		}
-		if writeToFile && set.WriteDynamics {
-			writeLine(*red, *blue, incomplete)
+		b.record(turn)
+		if status, over := b.callOff(); over {
+			return status
+		}
+		if !b.manoeuvre() || !b.armed() {
+			return Incomplete
+		}
+	}
+}
+
+// Bring in what is due at the start of the given turn: reinforcements,
+// resupply and recovery from suppression. Return how many units and rounds
+// arrived.
+func (b *Battle) startTurn(turn int) int {
+	n := b.reinforce(turn) + b.resupply()
+	b.rally()
+	return n
+}
+
+// Whether to call the battle off at the end of the current turn, and how:
+// as incomplete once MaxTurns turns have been fought, or as stalled once
+// nobody has been lost for StallTurns turns in a row.
+func (b *Battle) callOff() (Outcome, bool) {
+	lost := 0
+	for i := range b.forces {
+		// reinforcements add to both
+		lost += b.forces[i].forceSize - b.forces[i].size()
+	}
+	if lost > b.lost {
+		b.lost, b.quiet = lost, 0
+	} else {
+		b.quiet++
+	}
+	limit := b.MaxTurns
+	if limit == 0 {
+		limit = DefaultMaxTurns
+	}
+	if limit > 0 && b.turns >= limit {
+		return Incomplete, true
+	}
+	if b.StallTurns > 0 && b.quiet >= b.StallTurns {
+		return Stalled, true
+	}
+	return Incomplete, false
+}
+
+// Number of units in the fight on all sides
+func (b *Battle) pool() int {
+	n := 0
+	for i := range b.forces {
+		if !b.forces[i].routed {
+			n += b.forces[i].size()
+		}
+	}
+	return n
+}
+
+// The force, and the position among its living, of the k-th unit in the
+// fight, counting the forces in order
+func (b *Battle) pick(k int) (*force, int) {
+	for i := range b.forces {
+		f := &b.forces[i]
+		if f.routed {
+			continue
+		}
+		if k < f.size() {
+			return f, k
 		}
+		k -= f.size()
+	}
+	panic("lanchester: activation out of range")
+}
+
+func addCasualties(turn, killed []Casualties) {
+	for i := range turn {
+		turn[i] = append(turn[i], killed[i]...)
 	}
-	return false
 }
 
-func doCombatUniformAsync(red, blue *force, par parameters) bool {
+// Return the slice index of the living unit with the given id, or -1. Units
+// keep their creation order, so ids are sorted.
+func (f *force) find(id int) int {
+	if f.trackDead {
+		if f.forces[id].alive {
+			return id
+		}
+		return -1
+	}
+	i := sort.Search(len(f.forces), func(i int) bool { return f.forces[i].id >= id })
+	if i < len(f.forces) && f.forces[i].id == id {
+		return i
+	}
+	return -1
+}
+
+// Each living unit fires single shots as a Poisson process with a rate of
+// maxShots per unit of time, so it fires as many shots per turn on average
+// as in the turn-based engines, and its targeting policy aims them in
+// volleys of maxShots. Kills take effect immediately. Time is measured in
+// turns; the state is recorded at every whole turn and when the battle
+// ends.
+func (b *Battle) doCombatContinuous() Outcome {
+	turn := make([]Casualties, len(b.forces))
+	b.startTurn(1)
 	for {
-		turns++
-		for i := 0; i < len(red.forces)+len(blue.forces); i++ {
-			x := rand.Intn(len(red.forces) + len(blue.forces))
-			if x < len(red.forces) {
-				shoot(red.forces[x], blue)
-			} else {
-				shoot(blue.forces[x-len(red.forces)], red)
+		rate := 0.0
+		for i := range b.forces {
+			if !b.forces[i].routed {
+				rate += b.forces[i].fireRate()
 			}
-			//remove killed units
-			redKilled, blueKilled := removeKilled(red, blue)
-			if par.Verbose {
-				printCasualties(redKilled, blueKilled)
+		}
+		t := math.Inf(1)
+		if rate > 0 {
+			t = b.time + b.rng.ExpFloat64()/rate
+		} else if !b.armed() {
+			// nobody can fire, so nothing will ever happen
+			b.turns = int(math.Ceil(b.time))
+			b.record(turn)
+			return Incomplete
+		}
+		redraw := false
+		for float64(b.turns+1) <= t {
+			b.turns++
+			b.time = float64(b.turns)
+			b.record(turn)
+			turn = make([]Casualties, len(b.forces))
+			if status, over := b.callOff(); over {
+				return status
 			}
+			if !b.manoeuvre() {
+				return Incomplete
+			}
+			// arrivals change the rate of fire; fire is memoryless, so
+			// draw the next shot afresh from the start of the turn
+			if b.startTurn(b.turns+1) > 0 {
+				redraw = true
+				break
+			}
+		}
+		if redraw {
+			continue
+		}
+		b.time = t
 
-			if status := adjudicate(red, blue, red.forceSize, blue.forceSize, par); status != incomplete {
-				if writeToFile {
-					writeLine(*red, *blue, status)
+		// pick the shooter in proportion to its rate of fire; rounding
+		// error falls to the last unit in the fight
+		x := b.rng.Float64() * rate
+		var shooter *force
+		i := 0
+	pick:
+		for k := range b.forces {
+			f := &b.forces[k]
+			if f.routed || f.size() == 0 {
+				continue
+			}
+			shooter = f
+			for i = 0; i < f.size(); i++ {
+				if x < f.living(i).rate() {
+					break pick
 				}
-
-				return true
+				x -= f.living(i).rate()
 			}
+			i = f.size() - 1
 		}
-		if writeToFile && set.WriteDynamics {
-			writeLine(*red, *blue, incomplete)
+		// each shot continues the unit's volley of maxShots shots, aimed
+		// by a targeter of its own
+		a := &shooter.forces[shooter.index(i)]
+		if a.aim == nil {
+			a.aim = newTargeter(shooter.policy)
+		}
+		b.fire(a, shooter, 1)
+		if a.shot++; a.shot >= a.maxShots {
+			a.shot = 0
+		}
+
+		//remove killed units
+		killed := b.removeKilled()
+		b.printCasualties(killed)
+		addCasualties(turn, killed)
+
+		if status := b.adjudicate(); status != Incomplete {
+			b.turns = int(math.Ceil(b.time))
+			b.record(turn)
+			return status
 		}
 	}
-	return false
 }
 
-// Determine if one force should retreat.
-func adjudicate(red, blue *force, RedSize, BlueSize int, par parameters) Outcome {
-	_ = "breakpoint"
-	if float64(len(red.forces)) <= float64(RedSize)*red.retreatThreshold && float64(len(blue.forces)) <= float64(BlueSize)*blue.retreatThreshold {
-		return tie
-	} else if float64(len(red.forces)) <= float64(RedSize)*red.retreatThreshold {
-		return blueVictory
-	} else if float64(len(blue.forces)) <= float64(BlueSize)*blue.retreatThreshold {
-		return redVictory
+// Total rate of fire of the living units
+func (f *force) fireRate() float64 {
+	rate := 0.0
+	for i := 0; i < f.size(); i++ {
+		rate += f.living(i).rate()
 	}
-	return incomplete
+	return rate
 }
 
-//Remove all forces with health = 0. Return array of killed units.
-func removeKilled(red, blue *force) (casualties, casualties) {
-	redKilled := make([]int, 0)
-	blueKilled := make([]int, 0)
-	for i := 0; i < len(red.forces); i++ {
-		if red.forces[i].health <= 0 {
-			redKilled = append(redKilled, i)
-			if i < len(red.forces)-1 {
-				red.forces = append(red.forces[:i], red.forces[i+1:]...)
+// Determine which forces should retreat, and whether the battle is over:
+// it is once no two forces left standing are hostile to each other.
+func (b *Battle) adjudicate() Outcome {
+	var standing []int
+	for i := range b.forces {
+		f := &b.forces[i]
+		if float64(f.size()) <= float64(f.forceSize)*f.retreatThreshold || f.shaken() {
+			f.routed = true
+		}
+		if !f.routed {
+			standing = append(standing, i)
+		}
+	}
+	for _, i := range standing {
+		for _, j := range standing {
+			if b.hostile[i][j] || b.hostile[j][i] {
+				return Incomplete
+			}
+		}
+	}
+	b.victors = b.victors[:0]
+	for _, i := range standing {
+		b.victors = append(b.victors, b.forces[i].name)
+	}
+	if len(standing) == 0 {
+		return Tie
+	} else if len(b.Sides) > 0 {
+		return Victory
+	} else if standing[0] == 0 {
+		return RedVictory
+	}
+	return BlueVictory
+}
+
+// Append the end-of-turn state to the battle history.
+func (b *Battle) record(killed []Casualties) {
+	if b.counter != nil {
+		b.counter.endTurn(b)
+	}
+	t := float64(b.turns)
+	if b.ActivationOrder == ContinuousTime {
+		t = b.time
+	}
+	turn := Turn{
+		Turn:      b.turns,
+		Time:      t,
+		Forces:    make([]int, len(b.forces)),
+		ByType:    make([][]int, len(b.forces)),
+		Killed:    killed,
+		Committed: make([]int, len(b.forces)),
+		Rounds:    make([]int, len(b.forces)),
+		Broken:    make([]int, len(b.forces)),
+	}
+	for i := range b.forces {
+		turn.Forces[i] = b.forces[i].size()
+		turn.ByType[i] = b.forces[i].byType()
+		turn.Committed[i] = b.forces[i].forceSize
+		turn.Rounds[i] = b.forces[i].rounds()
+		turn.Broken[i] = b.forces[i].broken
+	}
+	turn.RedForces, turn.RedByType, turn.RedKilled = turn.Forces[0], turn.ByType[0], killed[0]
+	if len(b.forces) > 1 {
+		turn.BlueForces, turn.BlueByType, turn.BlueKilled = turn.Forces[1], turn.ByType[1], killed[1]
+	}
+	b.history = append(b.history, turn)
+}
+
+// Remove all forces with health = 0. Return array of killed units.
+func (b *Battle) removeKilled() []Casualties {
+	killed := make([]Casualties, len(b.forces))
+	for i := range b.forces {
+		killed[i] = b.forces[i].removeKilled()
+	}
+	return killed
+}
+
+// Remove the units of one force with health = 0, or mark them dead if dead
+// units are tracked. Broken units leave too, but are not casualties.
+func (f *force) removeKilled() Casualties {
+	killed := make([]int, 0)
+	if f.trackDead {
+		live := f.live[:0]
+		for _, i := range f.live {
+			if u := &f.forces[i]; u.health <= 0 || u.broken {
+				u.alive = false
+				if u.health <= 0 {
+					killed = append(killed, u.id)
+				} else {
+					f.broken++
+				}
 			} else {
-				red.forces = red.forces[:i]
+				live = append(live, i)
 			}
-			i--
 		}
+		f.live = live
+		return killed
 	}
-	for i := 0; i < len(blue.forces); i++ {
-		if blue.forces[i].health <= 0 {
-			blueKilled = append(blueKilled, i)
-			if i < len(blue.forces)-1 {
-				blue.forces = append(blue.forces[:i], blue.forces[i+1:]...)
+	for i := 0; i < len(f.forces); i++ {
+		if u := f.forces[i]; u.health <= 0 || u.broken {
+			if u.health <= 0 {
+				killed = append(killed, i)
+			} else {
+				f.broken++
+			}
+			if i < len(f.forces)-1 {
+				f.forces = append(f.forces[:i], f.forces[i+1:]...)
 			} else {
-				blue.forces = blue.forces[:i]
+				f.forces = f.forces[:i]
 			}
 			i--
 		}
 	}
-	return redKilled, blueKilled
+	return killed
+}
+
+// One agent fires up to maxShots shots at the opposing forces, aimed by its
+// own force's targeting policy.
+func (b *Battle) shoot(shooter *force, i int) {
+	a := &shooter.forces[i]
+	if b.counter != nil {
+		b.counter.activate(shooter, a.id)
+	}
+	b.fire(a, shooter, a.maxShots)
 }
 
-//One agent shoots at all opposing agents.
-func shoot(a unit, target *force) {
-	x := a.maxShots
-	for i := range target.forces { //TODO: non-random; doesn't matter unless I add heterogeneity
-		if rand.Float64() < a.shotProb && x > 0 {
+// Fire the given number of shots, or as many as a has rounds left for.
+// Against a single enemy force off the grid, the targeting policy aims at
+// that force directly; otherwise it aims at the enemy units the shooter can
+// engage, gathered from every force hostile to it.
+func (b *Battle) fire(a *unit, shooter *force, shots int) {
+	if a.ammo >= 0 && a.ammo < shots {
+		shots = a.ammo
+	}
+	enemies := b.enemies(shooter)
+	if b.Grid != nil || len(enemies) != 1 {
+		b.fireAt(a, shooter, enemies, shots)
+		return
+	}
+	target := enemies[0]
+	aim := shooter.aimer(a)
+	for shot := 0; shot < shots; shot++ {
+		i := aim.aim(b.rng, target, a.shot+shot)
+		if i < 0 {
+			return
+		}
+		a.expend()
+		target.suppress(i)
+		if b.rng.Float64() < a.hitProb() {
 			target.forces[i].health--
 		}
-		x--
 	}
 }
 
-func printCasualties(r, b casualties) {
-	printR := len(r) > 0
-	printB := len(b) > 0
-	if printR || printB {
-		fmt.Println()
-		if printR {
-			fmt.Printf("Red forces: %vkilled\n", r.String())
-		} else {
-			fmt.Printf("Blue forces: %vkilled\n", b.String())
-		}
-	}
-}
-
-// Write one line to the csv
-func writeLine(r, b force, status Outcome) {
-	s := make([]string, 16)
-	s[0] = fmt.Sprintf("%v", runNum)
-	s[1] = fmt.Sprintf("%v", par.ActivationOrder)
-	s[2] = fmt.Sprintf("%v", par.RedSize)
-	s[3] = fmt.Sprintf("%v", par.RedHealth)
-	s[4] = fmt.Sprintf("%.3v", par.RedShotProb)
-	s[5] = fmt.Sprintf("%v", par.RedMaxShots)
-	s[6] = fmt.Sprintf("%.3v", par.RedRetreatThreshold)
-	s[7] = fmt.Sprintf("%v", len(r.forces))
-	s[8] = fmt.Sprintf("%v", par.BlueSize)
-	s[9] = fmt.Sprintf("%v", par.BlueHealth)
-	s[10] = fmt.Sprintf("%.3v", par.BlueShotProb)
-	s[11] = fmt.Sprintf("%v", par.BlueMaxShots)
-	s[12] = fmt.Sprintf("%.3v", par.BlueRetreatThreshold)
-	s[13] = fmt.Sprintf("%v", len(b.forces))
-	s[14] = fmt.Sprintf("%v", status)
-	s[15] = fmt.Sprintf("%v", turns)
-	_ = "breakpoint"
-	err := w.Write(s)
-	if err != nil {
-		panic(err)
-	}
-	w.Flush()
-}
-
-// Write csv headers
-func writeHeader() {
-	headers := []string{"run", "activation-order", "red-size", "red-health", "red-shot-prob", "red-max-shots", "red-retreat-threshold", "red-forces", "blue-size", "blue-health", "blue-shot-prob", "blue-max-shots", "blue-retreat-threshold", "blue-forces", "victor", "turns"}
-	err := w.Write(headers)
-	if err != nil {
-		panic(err)
-	}
-}
-
-// Wrapper function for handling different activation orders
-func runModel(par parameters, runNum int) {
-	// initialize forces
-	red := createForce(par.RedSize, par.RedHealth, par.RedMaxShots, par.RedShotProb, par.RedRetreatThreshold)
-	blue := createForce(par.BlueSize, par.BlueHealth, par.BlueMaxShots, par.BlueShotProb, par.BlueRetreatThreshold)
-
-	//reset turns
-	turns = 0
-
-	//TODO: multiple verbosity levels
-	if set.Verbose {
-		fmt.Println()
-		fmt.Printf("Starting run number %v \n", runNum)
-		fmt.Println("Initial model state:")
-		fmt.Printf("The red force has %v.\n", red)
-		fmt.Printf("The blue force has %v.\n", blue)
-		fmt.Printf("Running model with %v activation:\n", par.ActivationOrder)
-	}
-	if par.ActivationOrder == randomSynchronous {
-		doCombatRandomSync(&red, &blue, par)
-	} else if par.ActivationOrder == uniformSynchronous {
-		doCombatUniform(&red, &blue, par)
-	} else if par.ActivationOrder == randomAsynchronous {
-		doCombatRandomAsync(&red, &blue, par)
-	} else if par.ActivationOrder == uniformAsynchronous {
-		doCombatUniformAsync(&red, &blue, par)
-	}
-	if set.Verbose {
-		fmt.Printf("\nModel finished after %v turns.\n\n", turns)
-		fmt.Println("Final model state:")
-		fmt.Printf("The red force has %v.\n", red)
-		fmt.Printf("The blue force %v.\n", blue)
-	}
-}
-
-func main() {
-
-	var file []byte
-	if len(os.Args) <= 1 {
-		// if no argument is specified, see if you can load the default file
-		if _, err := os.Stat("parameters.json"); !os.IsNotExist(err) {
-			fmt.Println("Using default parameter settings...")
-			file, err = ioutil.ReadFile("parameters.json")
-			if err != nil {
-				fmt.Println("Error opening parameter file")
-				os.Exit(2)
+// fireAt fires the given number of shots at the enemy units a can engage.
+// The shooter's targeting policy aims at a force made up of copies of those
+// units, and hits are passed on to the units themselves. On the grid a can
+// only engage the living enemies it can see within its range, its kill
+// probability falls off with the distance to the target and the cover the
+// target has.
+func (b *Battle) fireAt(a *unit, shooter *force, enemies []*force, shots int) {
+	type ref struct {
+		f *force
+		i int
+	}
+	var view force
+	var refs []ref
+	var t *Terrain
+	if b.Grid != nil {
+		t = b.Grid.Terrain
+	}
+	for _, f := range enemies {
+		for i := 0; i < f.size(); i++ {
+			u := f.living(i)
+			if b.Grid != nil && !(u.health > 0 && shooter.deployment.reaches(distance(*a, u)) && t.visible(*a, u)) {
+				continue
 			}
-		} else {
-			fmt.Println("Please provide a JSON file with the appropriate model parameters")
-			os.Exit(1)
-		}
-	} else {
-		var err error
-		file, err = ioutil.ReadFile(os.Args[1])
-		if err != nil {
-			fmt.Println("Error opening parameter file")
-			os.Exit(2)
+			view.forces = append(view.forces, u)
+			refs = append(refs, ref{f, f.index(i)})
 		}
 	}
-	// parse the JSON into model settings
-	err := json.Unmarshal(file, &set)
-	if err != nil {
-		fmt.Println("Error parsing JSON")
-		os.Exit(3)
-	}
-
-	// if there is a specified filename, writing to file is enabled, so create the file
-	// this will clobber the file
-	// TODO: prevent doing something stupid, like overwriting the source file
-	if set.Filename != "" {
-		writeToFile = true
-		var err error // paranoid about shadowing f
-		f, err = os.Create(set.Filename)
-		if err != nil {
-			panic(err)
+	aim := shooter.aimer(a)
+	for shot := 0; shot < shots; shot++ {
+		i := aim.aim(b.rng, &view, a.shot+shot)
+		if i < 0 {
+			return
+		}
+		a.expend()
+		refs[i].f.suppress(refs[i].i)
+		u := view.forces[i]
+		p := a.hitProb()
+		if b.Grid != nil {
+			p = shooter.deployment.killProb(*a, distance(*a, u)) * (1 - a.suppression) * (1 - t.cover(u))
+		}
+		if b.rng.Float64() < p {
+			view.forces[i].health--
+			refs[i].f.forces[refs[i].i].health--
 		}
-
-		defer f.Close()
-		w = csv.NewWriter(f)
-		defer w.Flush()
-
-		writeHeader()
-
 	}
-	rand.Seed(time.Now().UnixNano())
+}
 
-	switch set.BatchMode {
-	case singleRun:
-		runOnce()
+// The targeter that aims the shots of a, one of the force's units
+func (f *force) aimer(a *unit) targeter {
+	if a.aim != nil {
+		return a.aim
+	}
+	return f.targeting
+}
 
-	case parameterSweep:
-		// if running a parameter sweep, check with the user to make sure
-		// they know how many runs they're doing
-		sweepSize, ps := caluculateSweep()
-		reader := bufio.NewReader(os.Stdin)
-		fmt.Printf("Run parameter sweep with %v runs? (Y/n):  ", sweepSize)
-		text, err := reader.ReadString('\n')
-		if err != nil {
-			panic(err)
+func (b *Battle) printCasualties(killed []Casualties) {
+	if b.Log == nil {
+		return
+	}
+	first := true
+	for i, k := range killed {
+		if len(k) == 0 {
+			continue
 		}
-		text = strings.TrimRight(text, "\n")
-
-		if text == "N" || text == "n" {
-			fmt.Println("Cancelling")
-		} else {
-			fmt.Println("Continuing with parameter sweep")
-			executeSweep(ps)
+		if first {
+			fmt.Fprintln(b.Log)
+			first = false
 		}
-	case monteCarlo:
-		monteCarloRun()
+		name := b.forces[i].name
+		fmt.Fprintf(b.Log, "%v forces: %vkilled\n", strings.ToUpper(name[:1])+name[1:], k.String())
 	}
 }
@@ -0,0 +1,45 @@
+package lanchester
+
+import (
+	"math/rand"
+	"testing"
+)
+
+var allOrders = []ActivationOrder{RandomSynchronous, UniformSynchronous, RandomAsynchronous, UniformAsynchronous, ContinuousTime}
+
+func TestTurnLimits(t *testing.T) {
+	// nobody can hit anything
+	harmless := Parameters{RedSize: 5, RedHealth: 1, RedMaxShots: 1, BlueSize: 5, BlueHealth: 1, BlueMaxShots: 1}
+	// and here everybody does
+	deadly := Parameters{RedSize: 5, RedHealth: 1, RedShotProb: 1, RedMaxShots: 5, BlueSize: 5, BlueHealth: 1, BlueShotProb: 1, BlueMaxShots: 5}
+	for _, c := range []struct {
+		name       string
+		p          Parameters
+		max, stall int
+		outcome    Outcome
+		turns      int
+	}{
+		{"default limit", harmless, 0, 0, Incomplete, DefaultMaxTurns},
+		{"max turns", harmless, 50, 0, Incomplete, 50},
+		{"stall turns", harmless, 0, 7, Stalled, 7},
+		{"stall before max", harmless, 50, 7, Stalled, 7},
+		{"max before stall", harmless, 5, 7, Incomplete, 5},
+		{"no limit", deadly, -1, 0, Tie, 1},
+	} {
+		for _, order := range allOrders {
+			if c.name == "no limit" && (order == RandomAsynchronous || order == UniformAsynchronous || order == ContinuousTime) {
+				// kills take effect at once, so one side is left standing
+				continue
+			}
+			p := c.p
+			p.ActivationOrder, p.MaxTurns, p.StallTurns = order, c.max, c.stall
+			res := NewBattle(p, rand.New(rand.NewSource(1))).Run()
+			if res.Outcome != c.outcome || res.Turns != c.turns {
+				t.Errorf("%v, %v: %v after %v turns, want %v after %v", c.name, order, res.Outcome, res.Turns, c.outcome, c.turns)
+			}
+		}
+	}
+	if Tie.String() != "stalemate" || Stalled.String() != "stalled" || Incomplete.String() != "incomplete" {
+		t.Errorf("outcomes written %q, %q and %q", Tie, Stalled, Incomplete)
+	}
+}
@@ -0,0 +1,108 @@
+package lanchester
+
+import (
+	"math"
+	"math/rand"
+)
+
+// lhsDesign is an n x k Latin hypercube on the unit cube. Each column holds
+// exactly one point in each of the n equal-width strata of [0,1).
+type lhsDesign [][]float64
+
+// newLHSDesign draws a random Latin hypercube with n points in k
+// dimensions.
+func newLHSDesign(rng *rand.Rand, n, k int) lhsDesign {
+	d := make(lhsDesign, n)
+	for i := range d {
+		d[i] = make([]float64, k)
+	}
+	for j := 0; j < k; j++ {
+		perm := rng.Perm(n)
+		for i := 0; i < n; i++ {
+			d[i][j] = (float64(perm[i]) + rng.Float64()) / float64(n)
+		}
+	}
+	return d
+}
+
+// minDistance returns the smallest pairwise Euclidean distance between
+// design points. Larger is better under the maximin criterion.
+// This is O(n^2), so it is only practical for moderately sized designs.
+func (d lhsDesign) minDistance() float64 {
+	best := math.Inf(1)
+	for i := 0; i < len(d); i++ {
+		for k := i + 1; k < len(d); k++ {
+			dist := 0.0
+			for j := range d[i] {
+				x := d[i][j] - d[k][j]
+				dist += x * x
+			}
+			if dist < best {
+				best = dist
+			}
+		}
+	}
+	return math.Sqrt(best)
+}
+
+// maxCorrelation returns the largest absolute Pearson correlation between
+// any two columns of the design. Smaller is better.
+func (d lhsDesign) maxCorrelation() float64 {
+	if len(d) == 0 {
+		return 0
+	}
+	n := float64(len(d))
+	k := len(d[0])
+	mean, sd := make([]float64, k), make([]float64, k)
+	for j := 0; j < k; j++ {
+		for i := range d {
+			mean[j] += d[i][j]
+		}
+		mean[j] /= n
+		for i := range d {
+			x := d[i][j] - mean[j]
+			sd[j] += x * x
+		}
+		sd[j] = math.Sqrt(sd[j])
+	}
+	worst := 0.0
+	for a := 0; a < k; a++ {
+		for b := a + 1; b < k; b++ {
+			if sd[a] == 0 || sd[b] == 0 {
+				continue
+			}
+			cov := 0.0
+			for i := range d {
+				cov += (d[i][a] - mean[a]) * (d[i][b] - mean[b])
+			}
+			if r := math.Abs(cov / (sd[a] * sd[b])); r > worst {
+				worst = r
+			}
+		}
+	}
+	return worst
+}
+
+// buildLHS draws set.LHSCandidates random designs of n points in k
+// dimensions and keeps the best one under set.LHSCriterion ("maximin" or
+// "correlation"). With no criterion the first design is used as is.
+func (set *Settings) buildLHS(rng *rand.Rand, n, k int) lhsDesign {
+	best := newLHSDesign(rng, n, k)
+	if set.LHSCriterion == "" || set.LHSCandidates <= 1 {
+		return best
+	}
+	score := func(d lhsDesign) float64 {
+		if set.LHSCriterion == "maximin" {
+			return d.minDistance()
+		}
+		return -d.maxCorrelation()
+	}
+	bestScore := score(best)
+	for c := 1; c < set.LHSCandidates; c++ {
+		d := newLHSDesign(rng, n, k)
+		if s := score(d); s > bestScore {
+			best, bestScore = d, s
+		}
+	}
+	return best
+}
@@ -0,0 +1,51 @@
+package lanchester
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestLatinHypercube checks that a Latin hypercube batch puts exactly one
+// point in each stratum of every field it samples, and samples only the
+// fields that vary and have an effect.
+func TestLatinHypercube(t *testing.T) {
+	const n = 40
+	set := &Settings{
+		BatchMode:       LatinHypercube,
+		Niter:           n,
+		ActivationOrder: []ActivationOrder{RandomSynchronous},
+		RedSize:         [3]int{10, 20, 0},
+		RedHealth:       [3]int{1, 1, 0},
+		RedShotProb:     [3]float64{0.1, 0.5, 0},
+		RedMaxShots:     [3]int{1, 1, 0},
+		BlueSize:        [3]int{10, 49, 0},
+		BlueHealth:      [3]int{1, 1, 0},
+		BlueShotProb:    [3]float64{0.1, 0.5, 0},
+		BlueMaxShots:    [3]int{2, 2, 0},
+		RedUnits:        []UnitType{{Name: "rifle", Count: 15, Health: 1, ShotProb: 0.1, MaxShots: 2}},
+	}
+	for _, criterion := range []string{"", "maximin", "correlation"} {
+		set.LHSCriterion, set.LHSCandidates = criterion, 5
+		var sizes, probs [n]int
+		base := set.Base()
+		err := set.LatinHypercube(rand.New(rand.NewSource(1)), func(p Parameters) {
+			// 40 sizes from 10 to 49, one to a stratum
+			sizes[p.BlueSize-10]++
+			probs[int((p.BlueShotProb-0.1)/0.4*n)]++
+			if p.RedShotProb != base.RedShotProb || p.RedSize != base.RedSize {
+				t.Errorf("%q: red shot probability %v and size %v sampled", criterion, p.RedShotProb, p.RedSize)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			if sizes[i] != 1 || probs[i] != 1 {
+				t.Errorf("%q: stratum %v has %v blue sizes and %v blue shot probabilities", criterion, i, sizes[i], probs[i])
+			}
+		}
+	}
+	if rs := set.sampled(); len(rs) != 2 {
+		t.Errorf("sampled %v fields, want BlueSize and BlueShotProb", len(rs))
+	}
+}
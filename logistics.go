@@ -0,0 +1,115 @@
+package lanchester
+
+import "math"
+
+// supply tracks the resupply of a force: rate rounds per turn, with the
+// fraction of a round not yet delivered carried over.
+type supply struct {
+	rate float64
+	due  float64
+}
+
+// Rate of fire of a unit: maxShots shots per turn, or none once it has run
+// out of ammunition
+func (u unit) rate() float64 {
+	if u.ammo == 0 {
+		return 0
+	}
+	return float64(u.maxShots)
+}
+
+// Use up a round, unless ammunition is unlimited
+func (u *unit) expend() {
+	if u.ammo > 0 {
+		u.ammo--
+	}
+}
+
+// Deliver the rounds due to every force in the fight at the start of a
+// turn, and return how many were delivered. Rounds go to the living units
+// with the fewest rounds first, and never take a unit beyond the ammunition
+// it started with; rounds no unit can take are lost.
+func (b *Battle) resupply() int {
+	delivered := 0
+	for k := range b.forces {
+		f := &b.forces[k]
+		if f.routed || f.supply.rate == 0 {
+			continue
+		}
+		f.supply.due += f.supply.rate
+		n := math.Floor(f.supply.due)
+		f.supply.due -= n
+		delivered += f.deliver(int(n))
+	}
+	return delivered
+}
+
+// Hand out n rounds among the living units of f, a round at a time to each
+// of the units with the fewest, and return how many were taken.
+func (f *force) deliver(n int) int {
+	taken := 0
+	for n > 0 {
+		// the lowest level among the units that can take a round
+		level := -1
+		for i := 0; i < f.size(); i++ {
+			u := f.living(i)
+			if u.ammo >= 0 && u.ammo < f.types[u.kind].Ammo && (level < 0 || u.ammo < level) {
+				level = u.ammo
+			}
+		}
+		if level < 0 {
+			break
+		}
+		for i := 0; i < f.size() && n > 0; i++ {
+			u := &f.forces[f.index(i)]
+			if u.ammo == level {
+				u.ammo++
+				n--
+				taken++
+			}
+		}
+	}
+	return taken
+}
+
+// Whether the battle can still be decided by fire: whether any unit in the
+// fight has rounds left or any force in it is resupplied or still expecting
+// reinforcements.
+func (b *Battle) armed() bool {
+	for k := range b.forces {
+		f := &b.forces[k]
+		if f.routed {
+			continue
+		}
+		if f.supply.rate > 0 || f.reinforcements.pending(b.turns) {
+			return true
+		}
+		for i := 0; i < f.size(); i++ {
+			if f.living(i).ammo != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Rounds left to the living units of f with limited ammunition
+func (f *force) rounds() int {
+	n := 0
+	for i := 0; i < f.size(); i++ {
+		if u := f.living(i); u.ammo > 0 {
+			n += u.ammo
+		}
+	}
+	return n
+}
+
+// Whether any of the given unit types has limited ammunition
+func rationed(types []UnitType) bool {
+	for _, t := range types {
+		if t.Ammo > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package lanchester
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Morale subjects a force's units to suppression, between 0 and 1. Every
+// shot aimed at a unit, hit or miss, adds Suppression to it, and at the
+// start of every turn each unit recovers Recovery of it. A suppressed unit's
+// kill probability is scaled by (1 - suppression). A unit whose suppression
+// reaches Break breaks and routs, leaving the battle without being killed,
+// and the whole force routs once the mean suppression of its units in the
+// fight reaches Rout. A Break or Rout of 0 never triggers.
+//
+// The retreat threshold still applies, counting broken units as lost.
+type Morale struct {
+	Suppression float64 `json:"suppression"`
+	Recovery    float64 `json:"recovery"`
+	Break       float64 `json:"break"`
+	Rout        float64 `json:"rout"`
+}
+
+// Add the suppression of a shot at the i-th unit of f, breaking it if it
+// reaches the force's breaking point.
+func (f *force) suppress(i int) {
+	u := &f.forces[i]
+	if f.morale.Suppression == 0 || u.health <= 0 {
+		return
+	}
+	u.suppression += f.morale.Suppression
+	if u.suppression > 1 {
+		u.suppression = 1
+	}
+	if f.morale.Break > 0 && u.suppression >= f.morale.Break {
+		u.broken = true
+	}
+}
+
+// Kill probability of a unit's shots, reduced by its suppression
+func (u unit) hitProb() float64 {
+	return u.shotProb * (1 - u.suppression)
+}
+
+// Let the units of every force in the fight recover from suppression at
+// the start of a turn.
+func (b *Battle) rally() {
+	for k := range b.forces {
+		f := &b.forces[k]
+		if f.routed || f.morale.Recovery == 0 {
+			continue
+		}
+		for i := 0; i < f.size(); i++ {
+			u := &f.forces[f.index(i)]
+			u.suppression -= f.morale.Recovery
+			if u.suppression < 0 {
+				u.suppression = 0
+			}
+		}
+	}
+}
+
+// Whether the mean suppression of f's units in the fight has reached its
+// rout point
+func (f *force) shaken() bool {
+	if f.morale.Rout == 0 || f.size() == 0 {
+		return false
+	}
+	total := 0.0
+	for i := 0; i < f.size(); i++ {
+		total += f.living(i).suppression
+	}
+	return total/float64(f.size()) >= f.morale.Rout
+}
+
+// formatMorale encodes morale as suppression:recovery:break:rout, or
+// nothing if it is unset.
+func formatMorale(m Morale) string {
+	if m == (Morale{}) {
+		return ""
+	}
+	return fmt.Sprintf("%v:%v:%v:%v", formatFloat(m.Suppression), formatFloat(m.Recovery), formatFloat(m.Break), formatFloat(m.Rout))
+}
+
+// parseMorale is the inverse of formatMorale.
+func parseMorale(s string) (Morale, error) {
+	var m Morale
+	if s == "" {
+		return m, nil
+	}
+	f := strings.Split(s, ":")
+	if len(f) != 4 {
+		return m, fmt.Errorf("malformed morale %q", s)
+	}
+	var err [4]error
+	m.Suppression, err[0] = strconv.ParseFloat(f[0], 64)
+	m.Recovery, err[1] = strconv.ParseFloat(f[1], 64)
+	m.Break, err[2] = strconv.ParseFloat(f[2], 64)
+	m.Rout, err[3] = strconv.ParseFloat(f[3], 64)
+	for _, e := range err {
+		if e != nil {
+			return m, e
+		}
+	}
+	return m, nil
+}
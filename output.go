@@ -0,0 +1,397 @@
+package lanchester
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer writes battle results as CSV, one row per run or, when Dynamics is
+// set, one row per turn.
+//
+// If RedUnits or BlueUnits is set, each row also records the composition of
+// both forces and the survivors of every unit type. For each of Laws, each
+// row records the analytic force strengths at that turn along with the
+// predicted victor and duration; the job must carry those predictions. If
+// Grid is set, each row records the grid the battle was fought on and the
+// file its terrain was loaded from. If Reinforced is set, each row records
+// the reinforcement schedule of every force and the number of units it has
+// committed so far. If Ammo is set, each row records the ammunition and
+// resupply rate of every force and the rounds its living units have left,
+// which is empty for a force with unlimited ammunition. If Morale is set,
+// each row records the morale of every force and the number of its units
+// that have broken. If Limited is set, each row records the turn limits.
+//
+// If Sides is set, the runs are battles between those sides, and each row
+// records instead the composition, retreat threshold, targeting and
+// survivors of every side, and the hostility matrix; the victor is the
+// standing coalition, its sides joined by "+". Laws are not supported.
+type Writer struct {
+	Dynamics   bool
+	RedUnits   []UnitType
+	BlueUnits  []UnitType
+	Laws       []Law
+	Grid       *Grid
+	Sides      []Side
+	Reinforced bool
+	Ammo       bool
+	Morale     bool
+	Limited    bool
+
+	w *csv.Writer
+}
+
+// NewWriter returns a Writer that writes to w.
+func NewWriter(w io.Writer, dynamics bool) *Writer {
+	return &Writer{Dynamics: dynamics, w: csv.NewWriter(w)}
+}
+
+// Write csv headers
+func (w *Writer) WriteHeader() error {
+	if len(w.Sides) > 0 {
+		return w.writeSidesHeader()
+	}
+	headers := []string{"run", "seed", "activation-order", "red-size", "red-health", "red-shot-prob", "red-max-shots", "red-retreat-threshold", "red-forces", "blue-size", "blue-health", "blue-shot-prob", "blue-max-shots", "blue-retreat-threshold", "blue-forces", "victor", "turns", "red-targeting", "blue-targeting", "time", "track-dead"}
+	if w.typed() {
+		headers = append(headers, "red-units", "blue-units")
+		for i, t := range w.RedUnits {
+			headers = append(headers, "red-"+typeName(t, i)+"-forces")
+		}
+		for i, t := range w.BlueUnits {
+			headers = append(headers, "blue-"+typeName(t, i)+"-forces")
+		}
+	}
+	if w.Grid != nil {
+		headers = append(headers, "grid", "terrain")
+	}
+	if w.Reinforced {
+		headers = append(headers, "red-reinforcements", "blue-reinforcements", "red-committed", "blue-committed")
+	}
+	if w.Ammo {
+		headers = append(headers, "red-ammo", "blue-ammo", "red-resupply", "blue-resupply", "red-rounds", "blue-rounds")
+	}
+	if w.Morale {
+		headers = append(headers, "red-morale", "blue-morale", "red-broken", "blue-broken")
+	}
+	if w.Limited {
+		headers = append(headers, "max-turns", "stall-turns")
+	}
+	for _, l := range w.Laws {
+		headers = append(headers, l.String()+"-red-forces", l.String()+"-blue-forces", l.String()+"-victor", l.String()+"-turns")
+	}
+	if err := w.w.Write(headers); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Write the rows for one completed run. Only the final turn is written
+// unless Dynamics is set.
+func (w *Writer) Write(j Job) error {
+	res := j.Result
+	for i, t := range res.History {
+		last := i == len(res.History)-1
+		if !last && !w.Dynamics {
+			continue
+		}
+		status := Incomplete
+		if last {
+			status = res.Outcome
+		}
+		if err := w.writeLine(j, t, status); err != nil {
+			return err
+		}
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// Write one line to the csv. Floats are written at full precision so
+// that a row can be replayed exactly.
+func (w *Writer) writeLine(j Job, t Turn, status Outcome) error {
+	if len(w.Sides) > 0 {
+		return w.writeSidesLine(j, t, status)
+	}
+	par := j.Params
+	s := make([]string, 21)
+	s[0] = fmt.Sprintf("%v", j.Num)
+	s[1] = fmt.Sprintf("%v", j.Seed)
+	s[2] = fmt.Sprintf("%v", par.ActivationOrder)
+	s[3] = fmt.Sprintf("%v", par.RedSize)
+	s[4] = fmt.Sprintf("%v", par.RedHealth)
+	s[5] = formatFloat(par.RedShotProb)
+	s[6] = fmt.Sprintf("%v", par.RedMaxShots)
+	s[7] = formatFloat(par.RedRetreatThreshold)
+	s[8] = fmt.Sprintf("%v", t.RedForces)
+	s[9] = fmt.Sprintf("%v", par.BlueSize)
+	s[10] = fmt.Sprintf("%v", par.BlueHealth)
+	s[11] = formatFloat(par.BlueShotProb)
+	s[12] = fmt.Sprintf("%v", par.BlueMaxShots)
+	s[13] = formatFloat(par.BlueRetreatThreshold)
+	s[14] = fmt.Sprintf("%v", t.BlueForces)
+	s[15] = fmt.Sprintf("%v", status)
+	s[16] = fmt.Sprintf("%v", t.Turn)
+	s[17] = fmt.Sprintf("%v", par.RedTargeting)
+	s[18] = fmt.Sprintf("%v", par.BlueTargeting)
+	s[19] = formatFloat(t.Time)
+	s[20] = fmt.Sprintf("%v", par.TrackDead)
+	if w.typed() {
+		s = append(s, formatUnits(par.RedUnits), formatUnits(par.BlueUnits))
+		for i := range w.RedUnits {
+			s = append(s, fmt.Sprintf("%v", t.RedByType[i]))
+		}
+		for i := range w.BlueUnits {
+			s = append(s, fmt.Sprintf("%v", t.BlueByType[i]))
+		}
+	}
+	if w.Grid != nil {
+		terrain := ""
+		if par.Grid != nil {
+			terrain = par.Grid.TerrainFile
+		}
+		s = append(s, formatGrid(par.Grid, par.AllSides()), terrain)
+	}
+	if w.Reinforced {
+		s = append(s, formatReinforcements(par.RedReinforcements), formatReinforcements(par.BlueReinforcements),
+			fmt.Sprintf("%v", t.Committed[0]), fmt.Sprintf("%v", t.Committed[1]))
+	}
+	if w.Ammo {
+		red, blue := par.Forces()
+		s = append(s, fmt.Sprintf("%v", par.RedAmmo), fmt.Sprintf("%v", par.BlueAmmo), formatFloat(par.RedResupply), formatFloat(par.BlueResupply),
+			formatRounds(red, t.Rounds[0]), formatRounds(blue, t.Rounds[1]))
+	}
+	if w.Morale {
+		s = append(s, formatMorale(par.RedMorale), formatMorale(par.BlueMorale), fmt.Sprintf("%v", t.Broken[0]), fmt.Sprintf("%v", t.Broken[1]))
+	}
+	if w.Limited {
+		s = append(s, fmt.Sprintf("%v", par.MaxTurns), fmt.Sprintf("%v", par.StallTurns))
+	}
+	for i := range w.Laws {
+		tr := j.Analytic[i]
+		red, blue := tr.At(t.Turn)
+		s = append(s, fmt.Sprintf("%.2f", red), fmt.Sprintf("%.2f", blue), fmt.Sprintf("%v", tr.Outcome), fmt.Sprintf("%.2f", tr.Duration))
+	}
+	return w.w.Write(s)
+}
+
+func (w *Writer) writeSidesHeader() error {
+	sides := Parameters{Sides: w.Sides}.AllSides()
+	headers := []string{"run", "seed", "activation-order", "sides", "hostility"}
+	for _, side := range sides {
+		headers = append(headers, side.Name+"-units", side.Name+"-retreat-threshold", side.Name+"-targeting", side.Name+"-forces")
+	}
+	headers = append(headers, "victor", "turns", "time", "track-dead")
+	for _, side := range sides {
+		for i, t := range side.Units {
+			headers = append(headers, side.Name+"-"+typeName(t, i)+"-forces")
+		}
+	}
+	if w.Grid != nil {
+		headers = append(headers, "grid", "terrain")
+	}
+	if w.Reinforced {
+		for _, side := range sides {
+			headers = append(headers, side.Name+"-reinforcements", side.Name+"-committed")
+		}
+	}
+	if w.Ammo {
+		for _, side := range sides {
+			headers = append(headers, side.Name+"-resupply", side.Name+"-rounds")
+		}
+	}
+	if w.Morale {
+		for _, side := range sides {
+			headers = append(headers, side.Name+"-morale", side.Name+"-broken")
+		}
+	}
+	if w.Limited {
+		headers = append(headers, "max-turns", "stall-turns")
+	}
+	if err := w.w.Write(headers); err != nil {
+		return err
+	}
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *Writer) writeSidesLine(j Job, t Turn, status Outcome) error {
+	par := j.Params
+	sides := par.AllSides()
+	names := make([]string, len(sides))
+	for i, side := range sides {
+		names[i] = side.Name
+	}
+	s := []string{fmt.Sprintf("%v", j.Num), fmt.Sprintf("%v", j.Seed), fmt.Sprintf("%v", par.ActivationOrder),
+		strings.Join(names, ";"), formatHostility(par.hostility())}
+	for i, side := range sides {
+		s = append(s, formatUnits(side.Units), formatFloat(side.RetreatThreshold), fmt.Sprintf("%v", side.Targeting), fmt.Sprintf("%v", t.Forces[i]))
+	}
+	victor := fmt.Sprintf("%v", status)
+	if status == Victory {
+		victor = strings.Join(j.Result.Victors, "+")
+	}
+	s = append(s, victor, fmt.Sprintf("%v", t.Turn), formatFloat(t.Time), fmt.Sprintf("%v", par.TrackDead))
+	for i := range sides {
+		for _, n := range t.ByType[i] {
+			s = append(s, fmt.Sprintf("%v", n))
+		}
+	}
+	if w.Grid != nil {
+		terrain := ""
+		if par.Grid != nil {
+			terrain = par.Grid.TerrainFile
+		}
+		s = append(s, formatGrid(par.Grid, sides), terrain)
+	}
+	if w.Reinforced {
+		for i, side := range sides {
+			s = append(s, formatReinforcements(side.Reinforcements), fmt.Sprintf("%v", t.Committed[i]))
+		}
+	}
+	if w.Ammo {
+		for i, side := range sides {
+			s = append(s, formatFloat(side.Resupply), formatRounds(side.Units, t.Rounds[i]))
+		}
+	}
+	if w.Morale {
+		for i, side := range sides {
+			s = append(s, formatMorale(side.Morale), fmt.Sprintf("%v", t.Broken[i]))
+		}
+	}
+	if w.Limited {
+		s = append(s, fmt.Sprintf("%v", par.MaxTurns), fmt.Sprintf("%v", par.StallTurns))
+	}
+	return w.w.Write(s)
+}
+
+func (w *Writer) typed() bool {
+	return len(w.RedUnits) > 0 || len(w.BlueUnits) > 0
+}
+
+// typeName names the i-th unit type, falling back on its position.
+func typeName(t UnitType, i int) string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return fmt.Sprintf("type%v", i+1)
+}
+
+// formatRounds writes the rounds a force has left, or nothing if its
+// ammunition is unlimited.
+func formatRounds(types []UnitType, n int) string {
+	if !rationed(types) {
+		return ""
+	}
+	return fmt.Sprintf("%v", n)
+}
+
+// formatUnits encodes a force composition as
+// name:count:health:shotProb:maxShots entries separated by semicolons,
+// followed by :ammo for unit types with limited ammunition.
+func formatUnits(types []UnitType) string {
+	s := make([]string, len(types))
+	for i, t := range types {
+		s[i] = fmt.Sprintf("%v:%v:%v:%v:%v", t.Name, t.Count, t.Health, formatFloat(t.ShotProb), t.MaxShots)
+		if t.Ammo > 0 {
+			s[i] += fmt.Sprintf(":%v", t.Ammo)
+		}
+	}
+	return strings.Join(s, ";")
+}
+
+// parseUnits is the inverse of formatUnits.
+func parseUnits(s string) ([]UnitType, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var types []UnitType
+	for _, e := range strings.Split(s, ";") {
+		f := strings.Split(e, ":")
+		if len(f) != 5 && len(f) != 6 {
+			return nil, fmt.Errorf("malformed unit type %q", e)
+		}
+		t := UnitType{Name: f[0]}
+		var err [5]error
+		t.Count, err[0] = strconv.Atoi(f[1])
+		t.Health, err[1] = strconv.Atoi(f[2])
+		t.ShotProb, err[2] = strconv.ParseFloat(f[3], 64)
+		t.MaxShots, err[3] = strconv.Atoi(f[4])
+		if len(f) == 6 {
+			t.Ammo, err[4] = strconv.Atoi(f[5])
+		}
+		for _, e := range err {
+			if e != nil {
+				return nil, e
+			}
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// formatGrid encodes a grid as width:height followed by the deployment of
+// each side, depth:movement:speed:range:falloff:edge, separated by
+// semicolons.
+func formatGrid(g *Grid, sides []Side) string {
+	if g == nil {
+		return ""
+	}
+	s := []string{fmt.Sprintf("%v:%v", g.Width, g.Height)}
+	for _, side := range sides {
+		d := side.Deployment
+		s = append(s, fmt.Sprintf("%v:%v:%v:%v:%v:%v", d.Depth, d.Movement, d.Speed, formatFloat(d.Range), formatFloat(d.Falloff), d.Edge))
+	}
+	return strings.Join(s, ";")
+}
+
+// parseGrid is the inverse of formatGrid, returning the grid and the
+// deployment of each side. The edge of a deployment may be left out.
+func parseGrid(s string) (*Grid, []Deployment, error) {
+	if s == "" {
+		return nil, nil, nil
+	}
+	parts := strings.Split(s, ";")
+	size := strings.Split(parts[0], ":")
+	if len(size) != 2 {
+		return nil, nil, fmt.Errorf("malformed grid size %q", parts[0])
+	}
+	g := &Grid{}
+	var err [2]error
+	g.Width, err[0] = strconv.Atoi(size[0])
+	g.Height, err[1] = strconv.Atoi(size[1])
+	for _, e := range err {
+		if e != nil {
+			return nil, nil, e
+		}
+	}
+	deps := make([]Deployment, len(parts)-1)
+	for k := range deps {
+		dep := &deps[k]
+		f := strings.Split(parts[k+1], ":")
+		if len(f) != 5 && len(f) != 6 {
+			return nil, nil, fmt.Errorf("malformed deployment %q", parts[k+1])
+		}
+		var err [6]error
+		dep.Depth, err[0] = strconv.Atoi(f[0])
+		dep.Movement, err[1] = ParseMovement(f[1])
+		dep.Speed, err[2] = strconv.Atoi(f[2])
+		dep.Range, err[3] = strconv.ParseFloat(f[3], 64)
+		dep.Falloff, err[4] = strconv.ParseFloat(f[4], 64)
+		if len(f) == 6 {
+			dep.Edge, err[5] = ParseEdge(f[5])
+		}
+		for _, e := range err {
+			if e != nil {
+				return nil, nil, e
+			}
+		}
+	}
+	return g, deps, nil
+}
+
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
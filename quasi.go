@@ -0,0 +1,195 @@
+package lanchester
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// sobolPolynomials holds, for the second and later dimensions of the Sobol
+// sequence, the degree s and coefficients a of a primitive polynomial and
+// the initial direction numbers m, after Joe and Kuo (2008).
+var sobolPolynomials = []struct {
+	s, a int
+	m    []uint32
+}{
+	{1, 0, []uint32{1}},
+	{2, 1, []uint32{1, 3}},
+	{3, 1, []uint32{1, 3, 1}},
+	{3, 2, []uint32{1, 1, 1}},
+	{4, 1, []uint32{1, 1, 3, 3}},
+	{4, 4, []uint32{1, 3, 5, 13}},
+	{5, 2, []uint32{1, 1, 5, 5, 17}},
+	{5, 4, []uint32{1, 1, 5, 5, 5}},
+	{5, 7, []uint32{1, 1, 7, 11, 19}},
+	{5, 11, []uint32{1, 1, 5, 1, 1}},
+	{5, 13, []uint32{1, 1, 1, 3, 11}},
+	{5, 14, []uint32{1, 3, 5, 5, 31}},
+	{6, 1, []uint32{1, 3, 3, 9, 7, 49}},
+	{6, 13, []uint32{1, 1, 1, 15, 21, 21}},
+	{6, 16, []uint32{1, 3, 1, 13, 27, 49}},
+	{6, 19, []uint32{1, 1, 1, 15, 7, 5}},
+	{6, 22, []uint32{1, 3, 1, 15, 13, 25}},
+	{6, 25, []uint32{1, 1, 5, 5, 19, 61}},
+	{7, 1, []uint32{1, 3, 7, 11, 23, 15, 103}},
+	{7, 4, []uint32{1, 3, 7, 13, 13, 15, 69}},
+}
+
+// MaxSobolDims is the number of dimensions the Sobol sampler supports: the
+// first, plus one for each of sobolPolynomials.
+const MaxSobolDims = 21
+
+// sobol generates the points of a Sobol sequence with nested uniform
+// (Owen) scrambling, to 32 bits.
+type sobol struct {
+	// direction numbers, by dimension and bit
+	dirs [][32]uint32
+	// scrambling seed of each dimension
+	seeds []uint32
+}
+
+// newSobol returns a Sobol sequence of the given dimension, scrambled
+// independently in every dimension with seeds drawn from rng.
+func newSobol(dims int, rng *rand.Rand) (*sobol, error) {
+	if dims > MaxSobolDims {
+		return nil, fmt.Errorf("the Sobol sampler supports at most %v dimensions, not %v", MaxSobolDims, dims)
+	}
+	s := &sobol{dirs: make([][32]uint32, dims), seeds: make([]uint32, dims)}
+	for d := range s.dirs {
+		v := &s.dirs[d]
+		if d == 0 {
+			for k := range v {
+				v[k] = 1 << (31 - k)
+			}
+		} else {
+			p := sobolPolynomials[d-1]
+			for k := 0; k < 32; k++ {
+				if k < p.s {
+					v[k] = p.m[k] << (31 - k)
+					continue
+				}
+				v[k] = v[k-p.s] ^ v[k-p.s]>>p.s
+				for j := 1; j < p.s; j++ {
+					if p.a>>(p.s-1-j)&1 == 1 {
+						v[k] ^= v[k-j]
+					}
+				}
+			}
+		}
+		s.seeds[d] = rng.Uint32()
+	}
+	return s, nil
+}
+
+// point sets u to the i-th point of the sequence.
+func (s *sobol) point(i int, u []float64) {
+	for d := range u {
+		var x uint32
+		for k := 0; i>>k != 0 && k < 32; k++ {
+			if i>>k&1 == 1 {
+				x ^= s.dirs[d][k]
+			}
+		}
+		u[d] = float64(owenScramble(x, s.seeds[d])) / (1 << 32)
+	}
+}
+
+// owenScramble applies a nested uniform scramble to the binary digits of
+// x: each digit is flipped or not at random, depending on the seed and on
+// all the more significant digits. The hash is that of Burley (2020),
+// after Laine and Karras.
+func owenScramble(x, seed uint32) uint32 {
+	x = bits.Reverse32(x)
+	x += seed
+	x ^= x * 0x6c50b47c
+	x ^= x * 0xb82f1e52
+	x ^= x * 0xc7afe638
+	x ^= x * 0x8d22f6e6
+	return bits.Reverse32(x)
+}
+
+// halton sets u to the i-th point of the Halton sequence, whose d-th
+// coordinate is the radical inverse of i in the d-th prime base.
+func halton(i int, u []float64) {
+	p := 1
+	for d := range u {
+		p = nextPrime(p)
+		x, f := 0.0, 1.0
+		for n := i; n > 0; n /= p {
+			f /= float64(p)
+			x += f * float64(n%p)
+		}
+		u[d] = x
+	}
+}
+
+func nextPrime(n int) int {
+	for n++; !prime(n); n++ {
+	}
+	return n
+}
+
+// sampled returns the ranges of the settings that vary: the numeric fields
+// whose min is below their max and the categorical fields with more than
+// one level, but for those that the unit types or the sides override.
+// Fields that do not vary, or have no effect, would waste dimensions of a
+// low-discrepancy sequence or strata of a Latin hypercube.
+func (set *Settings) sampled() []parameterRange {
+	var rs []parameterRange
+	for _, r := range set.ranges() {
+		if set.overridden(r.name) {
+			continue
+		}
+		if r.kind == CategoricalAxis && len(r.levels) > 1 || r.kind != CategoricalAxis && r.min < r.max {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// at maps u in [0,1) onto the range: uniformly onto [min, max] for a real
+// field, onto each of the whole numbers from min to max with equal
+// probability for an integer field and onto each level of a categorical
+// field with equal probability.
+func (r parameterRange) at(u float64) float64 {
+	switch r.kind {
+	case CategoricalAxis:
+		k := int(u * float64(len(r.levels)))
+		if k >= len(r.levels) {
+			k = len(r.levels) - 1
+		}
+		return r.levels[k]
+	case IntegerAxis:
+		return math.Min(r.min+math.Floor(u*(r.max-r.min+1)), r.max)
+	}
+	return r.min + (r.max-r.min)*u
+}
+
+// QuasiRandom calls fn with the first set.Niter points of a Sobol or,
+// in Halton mode, a Halton sequence over the ranges of the settings that
+// vary. The Sobol points are Owen-scrambled with seeds drawn from rng, and
+// are best taken in powers of two; the Halton points are not scrambled,
+// and start from the first point after the origin.
+func (set *Settings) QuasiRandom(rng *rand.Rand, fn func(Parameters)) error {
+	rs := set.sampled()
+	point := func(i int, u []float64) { halton(i+1, u) }
+	if set.BatchMode == SobolSequence {
+		s, err := newSobol(len(rs), rng)
+		if err != nil {
+			return err
+		}
+		point = s.point
+	}
+	base := set.Base()
+	u := make([]float64, len(rs))
+	for i := 0; i < set.Niter; i++ {
+		point(i, u)
+		par := base
+		for d, r := range rs {
+			Axis{Name: r.name}.Set(&par, r.at(u[d]))
+		}
+		fn(par)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package lanchester
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestSobolStratified checks that the first 2^m points of the scrambled
+// Sobol sequence put exactly one point in each of the 2^m intervals of
+// equal length in every dimension, and in each of the 2^m boxes of every
+// shape in the first two dimensions, which form a (0, m, 2)-net.
+func TestSobolStratified(t *testing.T) {
+	const m = 8
+	const n = 1 << m
+	s, err := newSobol(MaxSobolDims, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := make([][]float64, n)
+	for i := range points {
+		points[i] = make([]float64, MaxSobolDims)
+		s.point(i, points[i])
+	}
+	for d := 0; d < MaxSobolDims; d++ {
+		var cells [n]int
+		for _, u := range points {
+			cells[int(u[d]*n)]++
+		}
+		for c, k := range cells {
+			if k != 1 {
+				t.Errorf("dimension %v: %v points in [%v, %v)", d, k, float64(c)/n, float64(c+1)/n)
+				break
+			}
+		}
+	}
+	for a := 0; a <= m; a++ {
+		var cells [n]int
+		for _, u := range points {
+			x, y := int(math.Ldexp(u[0], a)), int(math.Ldexp(u[1], m-a))
+			cells[x<<(m-a)|y]++
+		}
+		for c, k := range cells {
+			if k != 1 {
+				t.Errorf("boxes of 1/%v by 1/%v: %v points in box %v", 1<<a, 1<<(m-a), k, c)
+				break
+			}
+		}
+	}
+	if _, err := newSobol(MaxSobolDims+1, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("made a Sobol sequence of %v dimensions", MaxSobolDims+1)
+	}
+}
+
+func TestHalton(t *testing.T) {
+	for i, want := range [][]float64{
+		{0, 0, 0},
+		{1. / 2, 1. / 3, 1. / 5},
+		{1. / 4, 2. / 3, 2. / 5},
+		{3. / 4, 1. / 9, 3. / 5},
+		{1. / 8, 4. / 9, 4. / 5},
+		{5. / 8, 7. / 9, 1. / 25},
+	} {
+		u := make([]float64, len(want))
+		halton(i, u)
+		for d := range u {
+			if math.Abs(u[d]-want[d]) > 1e-12 {
+				t.Errorf("point %v is %v, want %v", i, u, want)
+				break
+			}
+		}
+	}
+}
+
+// TestQuasiRandom checks that a Sobol batch samples only the fields that
+// vary and have an effect, and spreads an integer field evenly over its
+// levels.
+func TestQuasiRandom(t *testing.T) {
+	set := &Settings{
+		BatchMode:       SobolSequence,
+		Niter:           64,
+		ActivationOrder: []ActivationOrder{RandomSynchronous, UniformAsynchronous},
+		RedSize:         [3]int{10, 20, 0},
+		RedHealth:       [3]int{1, 1, 0},
+		RedShotProb:     [3]float64{0.1, 0.2, 0},
+		RedMaxShots:     [3]int{1, 1, 0},
+		BlueSize:        [3]int{10, 13, 0},
+		BlueHealth:      [3]int{1, 1, 0},
+		BlueShotProb:    [3]float64{0.1, 0.2, 0},
+		BlueMaxShots:    [3]int{2, 2, 0},
+		RedUnits:        []UnitType{{Name: "rifle", Count: 15, Health: 1, ShotProb: 0.1, MaxShots: 2}},
+	}
+	var names []string
+	for _, r := range set.sampled() {
+		names = append(names, r.name)
+	}
+	if got, want := len(names), 3; got != want || names[0] != "ActivationOrder" || names[1] != "BlueSize" || names[2] != "BlueShotProb" {
+		t.Fatalf("sampled %v, want ActivationOrder, BlueSize and BlueShotProb", names)
+	}
+
+	base := set.Base()
+	orders := make(map[ActivationOrder]int)
+	sizes := make(map[int]int)
+	err := set.QuasiRandom(rand.New(rand.NewSource(1)), func(p Parameters) {
+		orders[p.ActivationOrder]++
+		sizes[p.BlueSize]++
+		if p.BlueShotProb < 0.1 || p.BlueShotProb > 0.2 {
+			t.Errorf("blue shot probability %v out of range", p.BlueShotProb)
+		}
+		if p.RedSize != base.RedSize || p.RedShotProb != base.RedShotProb {
+			t.Errorf("red size %v and shot probability %v sampled", p.RedSize, p.RedShotProb)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orders[RandomSynchronous] != 32 || orders[UniformAsynchronous] != 32 {
+		t.Errorf("activation orders drawn %v times", orders)
+	}
+	for size := 10; size <= 13; size++ {
+		if sizes[size] != 16 {
+			t.Errorf("blue sizes drawn %v times", sizes)
+			break
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package lanchester
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Reinforcement schedules units of one of a force's types (the first, if
+// Type is empty) to join it during the battle. Without a Rate, Count units
+// arrive at the start of the given Turn. With a Rate, units trickle in at
+// Rate per turn from the start of Turn on, as long as the force has fewer
+// than Below survivors (if Below is set), until Count units have arrived
+// (if Count is set).
+//
+// Reinforcements add to a force's committed strength, against which its
+// retreat threshold is measured. A routed force receives none.
+type Reinforcement struct {
+	Type  string  `json:"type"`
+	Count int     `json:"count"`
+	Turn  int     `json:"turn"`
+	Rate  float64 `json:"rate"`
+	Below int     `json:"below"`
+}
+
+// reinforcements tracks the progress of a force's reinforcement schedule.
+type reinforcements struct {
+	schedule []Reinforcement
+	// units arrived so far, and the fraction of a unit due, per entry
+	arrived []int
+	due     []float64
+}
+
+func newReinforcements(schedule []Reinforcement) reinforcements {
+	return reinforcements{schedule, make([]int, len(schedule)), make([]float64, len(schedule))}
+}
+
+// Bring in the reinforcements due at the start of the given turn, and
+// return how many arrived
+func (b *Battle) reinforce(turn int) int {
+	arrived := 0
+	for k := range b.forces {
+		f := &b.forces[k]
+		if f.routed {
+			continue
+		}
+		r := &f.reinforcements
+		for i, e := range r.schedule {
+			n := 0
+			switch {
+			case e.Rate == 0:
+				if turn == e.Turn {
+					n = e.Count
+				}
+			case turn >= e.Turn && (e.Count == 0 || r.arrived[i] < e.Count) && (e.Below == 0 || f.size() < e.Below):
+				r.due[i] += e.Rate
+				n = int(math.Floor(r.due[i]))
+				r.due[i] -= float64(n)
+				if e.Count > 0 && r.arrived[i]+n > e.Count {
+					n = e.Count - r.arrived[i]
+				}
+			}
+			r.arrived[i] += n
+			arrived += n
+			for ; n > 0; n-- {
+				b.add(f, f.typeIndex(e.Type))
+			}
+		}
+	}
+	return arrived
+}
+
+// Whether any reinforcements may still arrive after the given turn
+func (r *reinforcements) pending(turn int) bool {
+	for i, e := range r.schedule {
+		if e.Rate == 0 && e.Turn > turn || e.Rate > 0 && (e.Count == 0 || r.arrived[i] < e.Count) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add a fresh unit of the k-th type to a force
+func (b *Battle) add(f *force, k int) {
+	// ids must keep increasing, and in trackDead mode equal slice indices
+	u := newUnit(f.types[k], k, f.forceSize)
+	if f.trackDead {
+		f.live = append(f.live, len(f.forces))
+	}
+	if b.Grid != nil {
+		b.place(f, &u)
+	}
+	f.forces = append(f.forces, u)
+	f.forceSize++
+}
+
+// Index of the unit type with the given name, or the first type if name is
+// empty or unknown
+func (f *force) typeIndex(name string) int {
+	for k, t := range f.types {
+		if t.Name == name {
+			return k
+		}
+	}
+	return 0
+}
+
+// formatReinforcements encodes a reinforcement schedule as
+// type:count:turn:rate:below entries separated by semicolons.
+func formatReinforcements(rs []Reinforcement) string {
+	s := make([]string, len(rs))
+	for i, r := range rs {
+		s[i] = fmt.Sprintf("%v:%v:%v:%v:%v", r.Type, r.Count, r.Turn, formatFloat(r.Rate), r.Below)
+	}
+	return strings.Join(s, ";")
+}
+
+// parseReinforcements is the inverse of formatReinforcements.
+func parseReinforcements(s string) ([]Reinforcement, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var rs []Reinforcement
+	for _, e := range strings.Split(s, ";") {
+		f := strings.Split(e, ":")
+		if len(f) != 5 {
+			return nil, fmt.Errorf("malformed reinforcement %q", e)
+		}
+		r := Reinforcement{Type: f[0]}
+		var err [4]error
+		r.Count, err[0] = strconv.Atoi(f[1])
+		r.Turn, err[1] = strconv.Atoi(f[2])
+		r.Rate, err[2] = strconv.ParseFloat(f[3], 64)
+		r.Below, err[3] = strconv.Atoi(f[4])
+		for _, e := range err {
+			if e != nil {
+				return nil, e
+			}
+		}
+		rs = append(rs, r)
+	}
+	return rs, nil
+}
@@ -0,0 +1,353 @@
+package lanchester
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Replay re-runs one run of an existing output file from the parameters
+// and seed recorded in its rows. It returns the rerun job along with the
+// original rows and the rows the rerun produces, which are identical when
+// the run has been reproduced exactly. Both leave out the analytic
+// predictions, which the rerun does not recompute; any other column that
+// only one of them has is reported as a ColumnMismatch, along with the
+// rows restricted to the columns they share. Terrain is reloaded from the
+// file named in the output.
+func Replay(r io.Reader, run int) (j Job, original, replayed [][]string, err error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return j, nil, nil, err
+	}
+	if len(rows) == 0 {
+		return j, nil, nil, fmt.Errorf("empty output file")
+	}
+	col := make(map[string]int)
+	for i, h := range rows[0] {
+		col[h] = i
+	}
+	for _, h := range []string{"run", "seed"} {
+		if _, ok := col[h]; !ok {
+			return j, nil, nil, fmt.Errorf("output file has no %q column", h)
+		}
+	}
+	want := strconv.Itoa(run)
+	for _, row := range rows[1:] {
+		if row[col["run"]] == want {
+			original = append(original, row)
+		}
+	}
+	if len(original) == 0 {
+		return j, nil, nil, fmt.Errorf("run %v not found", run)
+	}
+
+	j.Num = run
+	if j.Params, j.Seed, err = parseRow(col, original[0]); err != nil {
+		return j, original, nil, err
+	}
+	j.Result = NewBattle(j.Params, rand.New(rand.NewSource(j.Seed))).Run()
+
+	// a run spread over several rows was written with dynamics
+	var buf bytes.Buffer
+	w := NewWriter(&buf, len(original) > 1)
+	w.RedUnits, w.BlueUnits = j.Params.RedUnits, j.Params.BlueUnits
+	w.Grid, w.Sides = j.Params.Grid, j.Params.Sides
+	_, w.Reinforced = col["red-reinforcements"]
+	_, w.Ammo = col["red-resupply"]
+	_, w.Morale = col["red-morale"]
+	_, w.Limited = col["max-turns"]
+	if len(j.Params.Sides) > 0 {
+		_, w.Reinforced = col[j.Params.Sides[0].Name+"-reinforcements"]
+		_, w.Ammo = col[j.Params.Sides[0].Name+"-resupply"]
+		_, w.Morale = col[j.Params.Sides[0].Name+"-morale"]
+	}
+	if err = w.WriteHeader(); err != nil {
+		return j, original, nil, err
+	}
+	if err = w.Write(j); err != nil {
+		return j, original, nil, err
+	}
+	replayed, err = csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		return j, original, nil, err
+	}
+	newCol := make(map[string]int)
+	for i, h := range replayed[0] {
+		newCol[h] = i
+	}
+	// compare the columns both files have, in the order of the original
+	var common []string
+	var mismatch ColumnMismatch
+	for _, h := range rows[0] {
+		if _, ok := newCol[h]; ok {
+			common = append(common, h)
+		} else if !analyticColumn(h) {
+			mismatch.Missing = append(mismatch.Missing, h)
+		}
+	}
+	for _, h := range replayed[0] {
+		if _, ok := col[h]; !ok {
+			mismatch.Extra = append(mismatch.Extra, h)
+		}
+	}
+	pick := func(rows [][]string, col map[string]int) [][]string {
+		picked := make([][]string, len(rows))
+		for k, row := range rows {
+			picked[k] = make([]string, len(common))
+			for i, h := range common {
+				if c := col[h]; c < len(row) {
+					picked[k][i] = row[c]
+				}
+			}
+		}
+		return picked
+	}
+	original, replayed = pick(original, col), pick(replayed[1:], newCol)
+	if len(mismatch.Missing) > 0 || len(mismatch.Extra) > 0 {
+		return j, original, replayed, &mismatch
+	}
+	return j, original, replayed, nil
+}
+
+// ColumnMismatch is the error Replay returns when the rerun does not write
+// the columns of the original file: Missing lists those it lacks and Extra
+// those the original lacks.
+type ColumnMismatch struct {
+	Missing, Extra []string
+}
+
+func (e *ColumnMismatch) Error() string {
+	var s []string
+	if len(e.Missing) > 0 {
+		s = append(s, "the rerun lacks columns "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Extra) > 0 {
+		s = append(s, "the output file lacks columns "+strings.Join(e.Extra, ", "))
+	}
+	return strings.Join(s, "; ")
+}
+
+// Whether a column holds the predictions of an analytic law
+func analyticColumn(h string) bool {
+	for l := LinearLaw; l <= HelmboldLaw; l++ {
+		for _, c := range []string{"-red-forces", "-blue-forces", "-victor", "-turns"} {
+			if h == l.String()+c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRow recovers the parameters and seed of a run from an output row.
+func parseRow(col map[string]int, row []string) (par Parameters, seed int64, err error) {
+	field := func(name string) string {
+		i, ok := col[name]
+		if !ok || i >= len(row) {
+			if err == nil {
+				err = fmt.Errorf("output file has no %q column", name)
+			}
+			return ""
+		}
+		return row[i]
+	}
+	atoi := func(name string) int {
+		x, e := strconv.Atoi(field(name))
+		if e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", name, e)
+		}
+		return x
+	}
+	atof := func(name string) float64 {
+		x, e := strconv.ParseFloat(field(name), 64)
+		if e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", name, e)
+		}
+		return x
+	}
+
+	seed, e := strconv.ParseInt(field("seed"), 10, 64)
+	if e != nil && err == nil {
+		err = fmt.Errorf("column %q: %v", "seed", e)
+	}
+	a, e := ParseActivationOrder(field("activation-order"))
+	if e != nil && err == nil {
+		err = e
+	}
+	var maxTurns, stallTurns int
+	if _, ok := col["max-turns"]; ok {
+		maxTurns, stallTurns = atoi("max-turns"), atoi("stall-turns")
+	}
+	if _, ok := col["sides"]; ok {
+		par, e = parseSides(col, row, field, atof)
+		if e != nil && err == nil {
+			err = e
+		}
+		par.ActivationOrder = a
+		par.MaxTurns, par.StallTurns = maxTurns, stallTurns
+		return par, seed, err
+	}
+	par = Parameters{
+		ActivationOrder:      a,
+		RedSize:              atoi("red-size"),
+		RedHealth:            atoi("red-health"),
+		RedShotProb:          atof("red-shot-prob"),
+		RedMaxShots:          atoi("red-max-shots"),
+		RedRetreatThreshold:  atof("red-retreat-threshold"),
+		BlueSize:             atoi("blue-size"),
+		BlueHealth:           atoi("blue-health"),
+		BlueShotProb:         atof("blue-shot-prob"),
+		BlueMaxShots:         atoi("blue-max-shots"),
+		BlueRetreatThreshold: atof("blue-retreat-threshold"),
+		MaxTurns:             maxTurns,
+		StallTurns:           stallTurns,
+	}
+	for _, name := range []string{"red-targeting", "blue-targeting"} {
+		// files written before targeting policies were added lack these
+		// columns, and their runs used sequential targeting
+		i, ok := col[name]
+		if !ok || i >= len(row) {
+			continue
+		}
+		t, e := ParseTargeting(row[i])
+		if e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", name, e)
+		}
+		if name == "red-targeting" {
+			par.RedTargeting = t
+		} else {
+			par.BlueTargeting = t
+		}
+	}
+	if i, ok := col["track-dead"]; ok && i < len(row) {
+		if par.TrackDead, e = strconv.ParseBool(row[i]); e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", "track-dead", e)
+		}
+	}
+	if i, ok := col["red-units"]; ok && i < len(row) {
+		if par.RedUnits, e = parseUnits(row[i]); e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", "red-units", e)
+		}
+	}
+	if i, ok := col["blue-units"]; ok && i < len(row) {
+		if par.BlueUnits, e = parseUnits(row[i]); e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", "blue-units", e)
+		}
+	}
+	deps, e := parseGridColumns(col, row, &par)
+	if e != nil && err == nil {
+		err = e
+	}
+	if len(deps) == 2 {
+		par.Grid.Red, par.Grid.Blue = deps[0], deps[1]
+	}
+	for _, name := range []string{"red-reinforcements", "blue-reinforcements"} {
+		i, ok := col[name]
+		if !ok || i >= len(row) {
+			continue
+		}
+		rs, e := parseReinforcements(row[i])
+		if e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", name, e)
+		}
+		if name == "red-reinforcements" {
+			par.RedReinforcements = rs
+		} else {
+			par.BlueReinforcements = rs
+		}
+	}
+	if _, ok := col["red-resupply"]; ok {
+		par.RedAmmo, par.BlueAmmo = atoi("red-ammo"), atoi("blue-ammo")
+		par.RedResupply, par.BlueResupply = atof("red-resupply"), atof("blue-resupply")
+	}
+	for _, name := range []string{"red-morale", "blue-morale"} {
+		i, ok := col[name]
+		if !ok || i >= len(row) {
+			continue
+		}
+		m, e := parseMorale(row[i])
+		if e != nil && err == nil {
+			err = fmt.Errorf("column %q: %v", name, e)
+		}
+		if name == "red-morale" {
+			par.RedMorale = m
+		} else {
+			par.BlueMorale = m
+		}
+	}
+	return par, seed, err
+}
+
+// parseSides recovers the sides of a battle between named sides from an
+// output row, along with the rest of its parameters but the activation
+// order.
+func parseSides(col map[string]int, row []string, field func(string) string, atof func(string) float64) (par Parameters, err error) {
+	names := strings.Split(field("sides"), ";")
+	if par.Hostility, err = parseHostility(field("hostility")); err != nil {
+		return par, fmt.Errorf("column %q: %v", "hostility", err)
+	}
+	if par.TrackDead, err = strconv.ParseBool(field("track-dead")); err != nil {
+		return par, fmt.Errorf("column %q: %v", "track-dead", err)
+	}
+	par.Sides = make([]Side, len(names))
+	for i, name := range names {
+		side := &par.Sides[i]
+		side.Name = name
+		if side.Units, err = parseUnits(field(name + "-units")); err != nil {
+			return par, fmt.Errorf("column %q: %v", name+"-units", err)
+		}
+		side.RetreatThreshold = atof(name + "-retreat-threshold")
+		if side.Targeting, err = ParseTargeting(field(name + "-targeting")); err != nil {
+			return par, fmt.Errorf("column %q: %v", name+"-targeting", err)
+		}
+		if i, ok := col[name+"-reinforcements"]; ok && i < len(row) {
+			if side.Reinforcements, err = parseReinforcements(row[i]); err != nil {
+				return par, fmt.Errorf("column %q: %v", name+"-reinforcements", err)
+			}
+		}
+		if _, ok := col[name+"-resupply"]; ok {
+			side.Resupply = atof(name + "-resupply")
+		}
+		if i, ok := col[name+"-morale"]; ok && i < len(row) {
+			if side.Morale, err = parseMorale(row[i]); err != nil {
+				return par, fmt.Errorf("column %q: %v", name+"-morale", err)
+			}
+		}
+	}
+	deps, err := parseGridColumns(col, row, &par)
+	if err != nil {
+		return par, err
+	}
+	if par.Grid != nil && len(deps) != len(par.Sides) {
+		return par, fmt.Errorf("column %q: %v deployments for %v sides", "grid", len(deps), len(par.Sides))
+	}
+	for i := range deps {
+		par.Sides[i].Deployment = deps[i]
+	}
+	return par, nil
+}
+
+// parseGridColumns recovers the grid and its terrain, if any, from an output
+// row, returning the deployment of each side.
+func parseGridColumns(col map[string]int, row []string, par *Parameters) ([]Deployment, error) {
+	i, ok := col["grid"]
+	if !ok || i >= len(row) {
+		return nil, nil
+	}
+	g, deps, err := parseGrid(row[i])
+	if err != nil {
+		return nil, fmt.Errorf("column %q: %v", "grid", err)
+	}
+	par.Grid = g
+	if i, ok := col["terrain"]; ok && i < len(row) && g != nil {
+		g.TerrainFile = row[i]
+		if err := g.LoadTerrain(); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
@@ -0,0 +1,112 @@
+package lanchester
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// replaySettings draws a few battles of each activation order at random
+// from the ranges, with and without unit types.
+const replaySettings = `{
+	"batchMode": 2,
+	"niter": 3,
+	"seed": 0,
+	"activationOrder": [0, 1, 2, 3, 4],
+	"RedSize": [10, 20, 0],
+	"RedHealth": [1, 2, 0],
+	"RedShotProb": [0.05, 0.2, 0],
+	"RedMaxShots": [1, 3, 0],
+	"RedRetreatThreshold": [0, 0.3, 0],
+	"BlueSize": [10, 20, 0],
+	"BlueHealth": [1, 2, 0],
+	"BlueShotProb": [0.05, 0.2, 0],
+	"BlueMaxShots": [1, 3, 0],
+	"BlueRetreatThreshold": [0, 0.3, 0]
+	%s
+}`
+
+// execute writes the output file of a batch.
+func execute(t *testing.T, set *Settings) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, set.WriteDynamics)
+	w.RedUnits, w.BlueUnits = set.RedUnits, set.BlueUnits
+	w.Laws = set.AnalyticLaws
+	w.Limited = set.MaxTurns != 0 || set.StallTurns != 0
+	if err := w.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Execute(w.Write); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReplay(t *testing.T) {
+	for _, extra := range []string{
+		``,
+		`, "writeDynamics": true`,
+		`, "analyticLaws": ["square"], "maxTurns": 50`,
+		`, "redUnits": [{"name": "rifle", "count": 12, "health": 1, "shotProb": 0.1, "maxShots": 1},
+			{"name": "mg", "count": 2, "health": 2, "shotProb": 0.05, "maxShots": 5}], "writeDynamics": true`,
+	} {
+		set, err := ParseSettings([]byte(strings.Replace(replaySettings, "%s", extra, 1)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !set.Seeded() {
+			t.Fatal("an explicit seed of 0 was not taken as chosen")
+		}
+		out := execute(t, set)
+		for run := 1; run <= set.BatchSize(); run++ {
+			j, original, replayed, err := Replay(bytes.NewReader(out), run)
+			if err != nil {
+				t.Fatalf("%q: run %v: %v", extra, run, err)
+			}
+			if j.Num != run || j.Seed != RunSeed(set.Seed, run) {
+				t.Errorf("%q: replayed run %v with seed %v, want run %v with seed %v", extra, j.Num, j.Seed, run, RunSeed(set.Seed, run))
+			}
+			if !reflect.DeepEqual(original, replayed) {
+				t.Errorf("%q: run %v replayed as\n%v\nwant\n%v", extra, run, replayed, original)
+			}
+		}
+	}
+}
+
+func TestReplayColumnMismatch(t *testing.T) {
+	set, err := ParseSettings([]byte(strings.Replace(replaySettings, "%s", "", 1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(execute(t, set))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// swap the track-dead column for one the rerun does not write
+	for i, h := range rows[0] {
+		if h == "track-dead" {
+			rows[0][i] = "note"
+		}
+	}
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(rows); err != nil {
+		t.Fatal(err)
+	}
+
+	_, original, replayed, err := Replay(&buf, 2)
+	mismatch, ok := err.(*ColumnMismatch)
+	if !ok {
+		t.Fatalf("got error %v, want a ColumnMismatch", err)
+	}
+	want := ColumnMismatch{Missing: []string{"note"}, Extra: []string{"track-dead"}}
+	if !reflect.DeepEqual(*mismatch, want) {
+		t.Errorf("got mismatch %+v, want %+v", *mismatch, want)
+	}
+	// the columns both have still match
+	if len(original[0]) != len(rows[0])-1 || !reflect.DeepEqual(original, replayed) {
+		t.Errorf("common columns replayed as\n%v\nwant\n%v", replayed, original)
+	}
+}
@@ -0,0 +1,322 @@
+package lanchester
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// Screening is a two-level design for finding the few factors that matter
+// among many in few runs. Each factor is an axis with a low and a high
+// level, and Runs[i][k] is -1 or +1 for the low or high level of factor k
+// in run i. The columns are balanced and mutually orthogonal, so the main
+// effect of every factor can be estimated independently of the others.
+type Screening struct {
+	Factors []Axis
+	Runs    [][]int
+}
+
+// maxGeneratorSearch bounds the search for the generators of a fractional
+// factorial with a given number of base factors before trying more.
+const maxGeneratorSearch = 100000
+
+// NewFractionalFactorial returns the 2^(k-p) fractional factorial design
+// of at least the given resolution over the k factors with the fewest
+// runs that can be found. The first k-p factors form a full factorial and
+// each of the rest is the product of several of them, chosen so that no
+// word of the defining relation is shorter than the resolution: at
+// resolution III no main effect is aliased with another, at IV nor with a
+// two-factor interaction, and at V no two-factor interaction is aliased
+// with another.
+func NewFractionalFactorial(factors []Axis, resolution int) *Screening {
+	k := len(factors)
+	for m := 0; m <= k; m++ {
+		if k > 1<<m-1 {
+			continue
+		}
+		gens, ok := generators(m, k-m, resolution)
+		if !ok {
+			continue
+		}
+		d := &Screening{Factors: factors, Runs: make([][]int, 1<<m)}
+		for r := range d.Runs {
+			d.Runs[r] = make([]int, k)
+			for j := 0; j < m; j++ {
+				d.Runs[r][j] = level(r>>j&1 == 1)
+			}
+			for g, mask := range gens {
+				// an even number of base factors at the low level
+				d.Runs[r][m+g] = level(bits.OnesCount(uint(^r&mask))%2 == 0)
+			}
+		}
+		return d
+	}
+	// m = k, the full factorial, always succeeds
+	panic("unreachable")
+}
+
+func level(high bool) int {
+	if high {
+		return 1
+	}
+	return -1
+}
+
+// generators searches for p interactions of m base factors, as bit masks,
+// that generate a fraction of the given resolution.
+func generators(m, p, resolution int) ([]int, bool) {
+	type word struct{ mask, gens int }
+	var words []word
+	var gens []int
+	nodes := 0
+	// fewer base factors than this in a generator make a word too short
+	minOrder := resolution - 1
+	if minOrder < 2 {
+		minOrder = 2
+	}
+	var search func(from int) bool
+	search = func(from int) bool {
+		if len(gens) == p {
+			return true
+		}
+		if nodes++; nodes > maxGeneratorSearch {
+			return false
+		}
+		// high-order interactions first, as they make the longest words
+		for order := m; order >= minOrder; order-- {
+			for g := from; g < 1<<m; g++ {
+				if bits.OnesCount(uint(g)) != order || contains(gens, g) {
+					continue
+				}
+				added := []word{{g, 1}}
+				for _, w := range words {
+					added = append(added, word{w.mask ^ g, w.gens + 1})
+				}
+				ok := true
+				for _, w := range added {
+					if bits.OnesCount(uint(w.mask))+w.gens < resolution {
+						ok = false
+						break
+					}
+				}
+				if !ok {
+					continue
+				}
+				n := len(words)
+				gens, words = append(gens, g), append(words, added...)
+				if search(0) {
+					return true
+				}
+				gens, words = gens[:len(gens)-1], words[:n]
+				if nodes > maxGeneratorSearch {
+					return false
+				}
+			}
+		}
+		return false
+	}
+	return gens, search(0)
+}
+
+func contains(xs []int, x int) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+// NewPlackettBurman returns a Plackett–Burman design over the factors: N
+// runs for up to N-1 factors, where N is the smallest multiple of four
+// above the number of factors that is a power of two (a Sylvester design)
+// or one more than a prime congruent to 3 mod 4 (a cyclic Paley design).
+// Main effects are estimated free of each other but are partially aliased
+// with every two-factor interaction.
+func NewPlackettBurman(factors []Axis) *Screening {
+	k := len(factors)
+	d := &Screening{Factors: factors}
+	for n := 4; ; n += 4 {
+		if n < k+1 {
+			continue
+		}
+		if n&(n-1) == 0 {
+			for r := 0; r < n; r++ {
+				row := make([]int, k)
+				for j := range row {
+					row[j] = level(bits.OnesCount(uint(r&(j+1)))%2 == 0)
+				}
+				d.Runs = append(d.Runs, row)
+			}
+			return d
+		}
+		if q := n - 1; q%4 == 3 && prime(q) {
+			residue := make([]bool, q)
+			for x := 1; x < q; x++ {
+				residue[x*x%q] = true
+			}
+			residue[0] = true
+			for r := 0; r < q; r++ {
+				row := make([]int, k)
+				for j := range row {
+					row[j] = level(residue[(j+r)%q])
+				}
+				d.Runs = append(d.Runs, row)
+			}
+			low := make([]int, k)
+			for j := range low {
+				low[j] = -1
+			}
+			d.Runs = append(d.Runs, low)
+			return d
+		}
+	}
+}
+
+func prime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for d := 2; d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Parameters returns base with the factors set to their levels in run i.
+func (d *Screening) Parameters(base Parameters, i int) Parameters {
+	for k, a := range d.Factors {
+		a.Set(&base, a.Levels[(d.Runs[i][k]+1)/2])
+	}
+	return base
+}
+
+// Screening returns the screening design of the batch mode over the
+// ranged numeric fields whose min is below their max, with each field's
+// min and max as its low and high levels. Fields that the unit types or
+// the sides override are left out.
+func (set *Settings) Screening() (*Screening, error) {
+	var factors []Axis
+	for _, r := range set.ranges() {
+		if r.kind != CategoricalAxis && r.min < r.max && !set.overridden(r.name) {
+			factors = append(factors, Axis{Name: r.name, Kind: r.kind, Levels: []float64{r.min, r.max}})
+		}
+	}
+	if len(factors) == 0 {
+		return nil, errors.New("no ranged field has a min below its max to screen")
+	}
+	if set.BatchMode == PlackettBurman {
+		return NewPlackettBurman(factors), nil
+	}
+	resolution := set.Resolution
+	if resolution == 0 {
+		resolution = 3
+	}
+	return NewFractionalFactorial(factors, resolution), nil
+}
+
+// Screen calls fn for every run of the screening design, set.Niter times
+// per run, under each of the activation orders in turn.
+func (set *Settings) Screen(fn func(Parameters)) error {
+	d, err := set.Screening()
+	if err != nil {
+		return err
+	}
+	base := set.Base()
+	for _, a := range set.ActivationOrder {
+		base.ActivationOrder = a
+		for i := range d.Runs {
+			par := d.Parameters(base, i)
+			for k := 0; k < set.Niter; k++ {
+				fn(par)
+			}
+		}
+	}
+	return nil
+}
+
+// The responses whose main effects are estimated
+const (
+	redWins = iota
+	blueWins
+	redSurvivors
+	blueSurvivors
+	responses
+)
+
+// Effect is the estimated main effect of a factor: the mean of each
+// response over the runs at the factor's high level less its mean over the
+// runs at its low level.
+type Effect struct {
+	Factor        string
+	Low, High     float64
+	RedVictory    float64
+	BlueVictory   float64
+	RedSurvivors  float64
+	BlueSurvivors float64
+}
+
+// MainEffects estimates the main effects of the factors of a screening
+// design from the battles run from it.
+type MainEffects struct {
+	design *Screening
+	// sum of each response and number of runs, by factor and level
+	sum [][2][responses]float64
+	n   [][2]int
+}
+
+// NewMainEffects returns an empty estimate for the factors of d.
+func NewMainEffects(d *Screening) *MainEffects {
+	return &MainEffects{
+		design: d,
+		sum:    make([][2][responses]float64, len(d.Factors)),
+		n:      make([][2]int, len(d.Factors)),
+	}
+}
+
+// Add adds a finished battle to the estimate at its run of the design, so
+// jobs must come from Settings.Execute.
+func (e *MainEffects) Add(j Job) {
+	if j.Point < 0 || j.Point >= len(e.design.Runs) {
+		return
+	}
+	var y [responses]float64
+	if j.Result.Outcome == RedVictory {
+		y[redWins] = 1
+	}
+	if j.Result.Outcome == BlueVictory {
+		y[blueWins] = 1
+	}
+	y[redSurvivors], y[blueSurvivors] = float64(j.Result.RedForces), float64(j.Result.BlueForces)
+	for k, x := range e.design.Runs[j.Point] {
+		l := (x + 1) / 2
+		e.n[k][l]++
+		for r := range y {
+			e.sum[k][l][r] += y[r]
+		}
+	}
+}
+
+// Effects returns the estimated main effect of every factor.
+func (e *MainEffects) Effects() []Effect {
+	effects := make([]Effect, len(e.design.Factors))
+	for k, a := range e.design.Factors {
+		var d [responses]float64
+		if e.n[k][0] > 0 && e.n[k][1] > 0 {
+			for r := range d {
+				d[r] = e.sum[k][1][r]/float64(e.n[k][1]) - e.sum[k][0][r]/float64(e.n[k][0])
+			}
+		}
+		effects[k] = Effect{
+			Factor:        a.Name,
+			Low:           a.Levels[0],
+			High:          a.Levels[1],
+			RedVictory:    d[redWins],
+			BlueVictory:   d[blueWins],
+			RedSurvivors:  d[redSurvivors],
+			BlueSurvivors: d[blueSurvivors],
+		}
+	}
+	return effects
+}
@@ -0,0 +1,179 @@
+package lanchester
+
+import (
+	"fmt"
+	"testing"
+)
+
+func screeningFactors(k int) []Axis {
+	factors := make([]Axis, k)
+	for i := range factors {
+		factors[i] = Axis{Name: fmt.Sprint("F", i), Kind: FloatAxis, Levels: []float64{0, 1}}
+	}
+	return factors
+}
+
+// checkBalanced checks that every column of the design has as many runs at
+// its high level as at its low, and that every pair of columns is
+// orthogonal.
+func checkBalanced(t *testing.T, name string, d *Screening) {
+	t.Helper()
+	k := len(d.Factors)
+	for i := 0; i < k; i++ {
+		var sum int
+		for _, run := range d.Runs {
+			sum += run[i]
+		}
+		if sum != 0 {
+			t.Errorf("%v: column %v sums to %v", name, i, sum)
+		}
+		for j := i + 1; j < k; j++ {
+			var dot int
+			for _, run := range d.Runs {
+				dot += run[i] * run[j]
+			}
+			if dot != 0 {
+				t.Errorf("%v: columns %v and %v have a dot product of %v", name, i, j, dot)
+			}
+		}
+	}
+}
+
+// aliased reports whether the products of the columns in a and in b are
+// the same or opposite in every run.
+func aliased(d *Screening, a, b []int) bool {
+	var dot int
+	for _, run := range d.Runs {
+		x := 1
+		for _, i := range a {
+			x *= run[i]
+		}
+		for _, i := range b {
+			x *= run[i]
+		}
+		dot += x
+	}
+	return dot == len(d.Runs) || dot == -len(d.Runs)
+}
+
+func TestFractionalFactorial(t *testing.T) {
+	for _, c := range []struct {
+		factors, resolution, runs int
+	}{
+		{1, 3, 2},
+		{3, 3, 4},
+		{7, 3, 8},
+		{15, 3, 16},
+		{4, 4, 8},
+		{8, 4, 16},
+		{5, 5, 16},
+		{6, 5, 32},
+	} {
+		name := fmt.Sprintf("%v factors at resolution %v", c.factors, c.resolution)
+		d := NewFractionalFactorial(screeningFactors(c.factors), c.resolution)
+		if len(d.Runs) != c.runs {
+			t.Errorf("%v: %v runs, want %v", name, len(d.Runs), c.runs)
+		}
+		checkBalanced(t, name, d)
+
+		k := c.factors
+		for i := 0; i < k; i++ {
+			for j := 0; j < k; j++ {
+				for l := j + 1; l < k; l++ {
+					if c.resolution >= 4 && i != j && i != l && aliased(d, []int{i}, []int{j, l}) {
+						t.Errorf("%v: main effect %v aliased with interaction %v%v", name, i, j, l)
+					}
+					if c.resolution < 5 || i >= j {
+						continue
+					}
+					for m := i + 1; m < k; m++ {
+						if m != j && m != l && aliased(d, []int{i, m}, []int{j, l}) {
+							t.Errorf("%v: interaction %v%v aliased with interaction %v%v", name, i, m, j, l)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestPlackettBurman(t *testing.T) {
+	for _, c := range []struct {
+		factors, runs int
+	}{
+		{3, 4},
+		{7, 8},
+		{8, 12},
+		{11, 12},
+		{15, 16},
+		{19, 20},
+		{23, 24},
+	} {
+		name := fmt.Sprintf("%v factors", c.factors)
+		d := NewPlackettBurman(screeningFactors(c.factors))
+		if len(d.Runs) != c.runs {
+			t.Errorf("%v: %v runs, want %v", name, len(d.Runs), c.runs)
+		}
+		checkBalanced(t, name, d)
+	}
+}
+
+// TestScreen runs a screening batch whose red force is made of unit types,
+// so that the red size, health, shot probability and max shots are not
+// factors, and checks that every job is matched to the design row it was
+// run from.
+func TestScreen(t *testing.T) {
+	set := &Settings{
+		BatchMode:       FractionalFactorial,
+		Niter:           3,
+		Seed:            1,
+		Workers:         3,
+		ActivationOrder: []ActivationOrder{RandomSynchronous, UniformSynchronous},
+		RedSize:         [3]int{10, 20, 0},
+		RedHealth:       [3]int{1, 2, 0},
+		RedShotProb:     [3]float64{0.1, 0.2, 0},
+		RedMaxShots:     [3]int{1, 2, 0},
+		BlueSize:        [3]int{10, 20, 0},
+		BlueHealth:      [3]int{1, 1, 0},
+		BlueShotProb:    [3]float64{0.1, 0.2, 0},
+		BlueMaxShots:    [3]int{1, 3, 0},
+		RedUnits:        []UnitType{{Name: "rifle", Count: 15, Health: 1, ShotProb: 0.1, MaxShots: 2}},
+	}
+	d, err := set.Screening()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range d.Factors {
+		names = append(names, a.Name)
+	}
+	if got, want := fmt.Sprint(names), "[BlueSize BlueShotProb BlueMaxShots]"; got != want {
+		t.Fatalf("factors %v, want %v", got, want)
+	}
+
+	base := set.Base()
+	effects := NewMainEffects(d)
+	n := 0
+	err = set.Execute(func(j Job) error {
+		n++
+		want := d.Parameters(base, j.Point)
+		for _, a := range d.Factors {
+			if a.Get(j.Params) != a.Get(want) {
+				t.Errorf("run %v: %v is %v, but design row %v has %v", j.Num, a.Name, a.Get(j.Params), j.Point, a.Get(want))
+			}
+		}
+		effects.Add(j)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != set.BatchSize() {
+		t.Errorf("%v runs, want %v", n, set.BatchSize())
+	}
+	for k := range d.Factors {
+		if effects.n[k][0] != n/2 || effects.n[k][1] != n/2 {
+			t.Errorf("factor %v has %v runs at each level, want %v", k, effects.n[k], n/2)
+		}
+	}
+}
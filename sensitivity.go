@@ -0,0 +1,341 @@
+package lanchester
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// SensitivityResponses names the responses whose sensitivity to the
+// parameters is analysed: whether red won, the survivors of each force
+// and the length of the battle in turns.
+var SensitivityResponses = [...]string{"red-victory", "red-survivors", "blue-survivors", "turns"}
+
+type sensitivityResponse [len(SensitivityResponses)]float64
+
+func responsesOf(r Result) sensitivityResponse {
+	var y sensitivityResponse
+	if r.Outcome == RedVictory {
+		y[0] = 1
+	}
+	y[1], y[2], y[3] = float64(r.RedForces), float64(r.BlueForces), float64(r.Turns)
+	return y
+}
+
+// Sensitivity is a design for global sensitivity analysis over the fields
+// of the settings that vary and are not overridden, on the unit cube:
+// Points[i][k] in [0,1] is the position of factor k within its range at
+// design point i.
+//
+// A Saltelli design (batch mode SobolIndices) has N blocks of k+2 points:
+// a point of a matrix A, the same row of a matrix B, and the row of A with
+// each factor in turn taken from B. A Morris design (batch mode Morris)
+// has N trajectories of k+1 points on a grid of MorrisLevels levels, each
+// moving one factor at a time by a fixed step.
+type Sensitivity struct {
+	Method  BatchMode
+	Factors []string
+	Points  [][]float64
+	N       int
+
+	ranges     []parameterRange
+	base       Parameters
+	replicates int
+	// the factor moved, and by how much, to reach each point of a Morris
+	// trajectory after the first
+	moved []int
+	step  []float64
+}
+
+// Sensitivity returns the sensitivity analysis design of the batch mode,
+// with set.Niter blocks or trajectories. The design is drawn from a
+// generator seeded with set.Seed, so that the same settings always give
+// the same design.
+func (set *Settings) Sensitivity() (*Sensitivity, error) {
+	rs := set.sampled()
+	if len(rs) == 0 {
+		return nil, errors.New("no field varies, so there is nothing to analyse")
+	}
+	d := &Sensitivity{Method: set.BatchMode, N: set.Niter, ranges: rs, base: set.Base(), replicates: set.Replicates}
+	if d.replicates < 1 {
+		d.replicates = 1
+	}
+	for _, r := range rs {
+		d.Factors = append(d.Factors, r.name)
+	}
+	rng := rand.New(rand.NewSource(set.Seed))
+	k := len(rs)
+	if set.BatchMode == Morris {
+		levels := set.MorrisLevels
+		if levels < 2 {
+			levels = 4
+		}
+		d.morris(rng, k, levels)
+		return d, nil
+	}
+
+	// A and B from the two halves of a scrambled Sobol sequence if it has
+	// the dimensions, and at random otherwise
+	point := func(i int, u []float64) {
+		for j := range u {
+			u[j] = rng.Float64()
+		}
+	}
+	if 2*k <= MaxSobolDims {
+		s, err := newSobol(2*k, rng)
+		if err != nil {
+			return nil, err
+		}
+		point = s.point
+	}
+	u := make([]float64, 2*k)
+	for i := 0; i < d.N; i++ {
+		point(i, u)
+		a, b := append([]float64(nil), u[:k]...), append([]float64(nil), u[k:]...)
+		d.Points = append(d.Points, a, b)
+		for j := 0; j < k; j++ {
+			ab := append([]float64(nil), a...)
+			ab[j] = b[j]
+			d.Points = append(d.Points, ab)
+		}
+	}
+	return d, nil
+}
+
+// Build N Morris trajectories of k factors on a grid of the given number
+// of levels, with the usual step of levels/(2(levels-1)).
+func (d *Sensitivity) morris(rng *rand.Rand, k, levels int) {
+	delta := float64(levels) / float64(2*(levels-1))
+	for t := 0; t < d.N; t++ {
+		x := make([]float64, k)
+		for j := range x {
+			x[j] = float64(rng.Intn(levels)) / float64(levels-1)
+		}
+		d.Points = append(d.Points, x)
+		d.moved, d.step = append(d.moved, -1), append(d.step, 0)
+		for _, j := range rng.Perm(k) {
+			x = append([]float64(nil), x...)
+			up := x[j]+delta <= 1
+			if down := x[j]-delta >= 0; up && down {
+				up = rng.Intn(2) == 0
+			}
+			step := delta
+			if !up {
+				step = -delta
+			}
+			x[j] += step
+			d.Points = append(d.Points, x)
+			d.moved, d.step = append(d.moved, j), append(d.step, step)
+		}
+	}
+}
+
+// Runs returns the number of battles the design takes.
+func (d *Sensitivity) Runs() int {
+	return len(d.Points) * d.replicates
+}
+
+// Parameters returns the parameters of design point i.
+func (d *Sensitivity) Parameters(i int) Parameters {
+	par := d.base
+	for k, r := range d.ranges {
+		Axis{Name: r.name}.Set(&par, r.at(d.Points[i][k]))
+	}
+	return par
+}
+
+// Analyse calls fn for every point of the sensitivity analysis design,
+// set.Replicates times (once if 0) per point.
+func (set *Settings) Analyse(fn func(Parameters)) error {
+	d, err := set.Sensitivity()
+	if err != nil {
+		return err
+	}
+	for i := range d.Points {
+		par := d.Parameters(i)
+		for k := 0; k < d.replicates; k++ {
+			fn(par)
+		}
+	}
+	return nil
+}
+
+// SensitivityAnalysis collects the responses of the battles of a
+// sensitivity analysis design, averaged over the replicates of each point,
+// and estimates the sensitivity indices from them.
+type SensitivityAnalysis struct {
+	design *Sensitivity
+	y      []sensitivityResponse
+	// bootstrap resamples and the generator that draws them
+	resamples int
+	rng       *rand.Rand
+}
+
+// NewSensitivityAnalysis returns an empty analysis of design d, whose
+// confidence intervals come from the given number of bootstrap resamples
+// (1000 if 0) drawn with a generator seeded with seed.
+func NewSensitivityAnalysis(d *Sensitivity, resamples int, seed int64) *SensitivityAnalysis {
+	if resamples <= 0 {
+		resamples = 1000
+	}
+	return &SensitivityAnalysis{
+		design:    d,
+		y:         make([]sensitivityResponse, len(d.Points)),
+		resamples: resamples,
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Add adds a finished battle to the analysis at its design point, so jobs
+// must come from Settings.Execute.
+func (a *SensitivityAnalysis) Add(j Job) {
+	i := j.Point
+	if i < 0 || i >= len(a.y) {
+		return
+	}
+	y := responsesOf(j.Result)
+	for r := range y {
+		a.y[i][r] += y[r] / float64(a.design.replicates)
+	}
+}
+
+// SobolIndex is the first-order and total-effect Sobol index of a factor
+// for a response, each with a 95% bootstrap confidence interval. The
+// first-order index is the share of the variance of the response due to
+// the factor alone; the total-effect index adds its share of every
+// interaction.
+type SobolIndex struct {
+	Factor, Response           string
+	First, FirstLow, FirstHigh float64
+	Total, TotalLow, TotalHigh float64
+}
+
+// SobolIndices estimates the Sobol indices of every factor for every
+// response from a Saltelli design, with the estimators of Saltelli et al.
+// (2010) for the first-order index and of Jansen (1999) for the total.
+func (a *SensitivityAnalysis) SobolIndices() []SobolIndex {
+	d := a.design
+	k := len(d.Factors)
+	block := k + 2
+	var out []SobolIndex
+	for r, name := range SensitivityResponses {
+		f := func(j, p int) float64 { return a.y[j*block+p][r] }
+		estimate := func(rows []int) (first, total []float64) {
+			var all []float64
+			for _, j := range rows {
+				all = append(all, f(j, 0), f(j, 1))
+			}
+			_, v := meanVar(all)
+			first, total = make([]float64, k), make([]float64, k)
+			if v == 0 {
+				return first, total
+			}
+			for i := 0; i < k; i++ {
+				var s, t float64
+				for _, j := range rows {
+					fa, fb, fab := f(j, 0), f(j, 1), f(j, 2+i)
+					s += fb * (fab - fa)
+					t += (fa - fab) * (fa - fab)
+				}
+				n := float64(len(rows))
+				first[i], total[i] = s/n/v, t/(2*n)/v
+			}
+			return first, total
+		}
+		rows := make([]int, d.N)
+		for j := range rows {
+			rows[j] = j
+		}
+		first, total := estimate(rows)
+		bootFirst, bootTotal := make([][]float64, k), make([][]float64, k)
+		for b := 0; b < a.resamples; b++ {
+			for j := range rows {
+				rows[j] = a.rng.Intn(d.N)
+			}
+			s, t := estimate(rows)
+			for i := 0; i < k; i++ {
+				bootFirst[i] = append(bootFirst[i], s[i])
+				bootTotal[i] = append(bootTotal[i], t[i])
+			}
+		}
+		for i, factor := range d.Factors {
+			x := SobolIndex{Factor: factor, Response: name, First: first[i], Total: total[i]}
+			x.FirstLow, x.FirstHigh = interval(bootFirst[i])
+			x.TotalLow, x.TotalHigh = interval(bootTotal[i])
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// MorrisEffect summarises the elementary effects of a factor on a
+// response, in units of the response per whole range of the factor: Mu is
+// their mean, MuStar the mean of their absolute values, with a 95%
+// bootstrap confidence interval, and Sigma their standard deviation. A
+// large MuStar marks an influential factor, and a large Sigma one that
+// acts through interactions or nonlinearly.
+type MorrisEffect struct {
+	Factor, Response      string
+	Mu, MuStar, Sigma     float64
+	MuStarLow, MuStarHigh float64
+}
+
+// MorrisEffects estimates the Morris statistics of every factor for every
+// response from a Morris design.
+func (a *SensitivityAnalysis) MorrisEffects() []MorrisEffect {
+	d := a.design
+	k := len(d.Factors)
+	block := k + 1
+	var out []MorrisEffect
+	for r, name := range SensitivityResponses {
+		// elementary effects by factor and trajectory
+		ee := make([][]float64, k)
+		for t := 0; t < d.N; t++ {
+			for p := 1; p < block; p++ {
+				i := t*block + p
+				j := d.moved[i]
+				ee[j] = append(ee[j], (a.y[i][r]-a.y[i-1][r])/d.step[i])
+			}
+		}
+		for j, factor := range d.Factors {
+			x := MorrisEffect{Factor: factor, Response: name}
+			x.Mu, x.MuStar, x.Sigma = morrisStats(ee[j])
+			if len(ee[j]) == 0 {
+				x.MuStarLow, x.MuStarHigh = interval(nil)
+				out = append(out, x)
+				continue
+			}
+			boot := make([]float64, a.resamples)
+			sample := make([]float64, len(ee[j]))
+			for b := range boot {
+				for t := range sample {
+					sample[t] = ee[j][a.rng.Intn(len(ee[j]))]
+				}
+				_, boot[b], _ = morrisStats(sample)
+			}
+			x.MuStarLow, x.MuStarHigh = interval(boot)
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func morrisStats(ee []float64) (mu, muStar, sigma float64) {
+	abs := make([]float64, len(ee))
+	for i, x := range ee {
+		abs[i] = math.Abs(x)
+	}
+	mu, v := meanVar(ee)
+	muStar, _ = meanVar(abs)
+	return mu, muStar, math.Sqrt(v)
+}
+
+// The central 95% of a bootstrap distribution
+func interval(boot []float64) (low, high float64) {
+	if len(boot) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	sort.Float64s(boot)
+	return quantile(boot, 0.025), quantile(boot, 0.975)
+}
@@ -0,0 +1,79 @@
+package lanchester
+
+import (
+	"math"
+	"testing"
+)
+
+// linearAnalysis returns the analysis of a design over three real fields
+// in which every response is the linear function a·x of the position x of
+// the design point on the unit cube.
+func linearAnalysis(t *testing.T, mode BatchMode, n int, a [3]float64) *SensitivityAnalysis {
+	t.Helper()
+	set := &Settings{
+		BatchMode:           mode,
+		Niter:               n,
+		Seed:                1,
+		ActivationOrder:     []ActivationOrder{RandomSynchronous},
+		RedShotProb:         [3]float64{0, 1, 0},
+		RedRetreatThreshold: [3]float64{0, 1, 0},
+		BlueShotProb:        [3]float64{0, 1, 0},
+	}
+	d, err := set.Sensitivity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Factors) != 3 {
+		t.Fatalf("factors %v, want three", d.Factors)
+	}
+	analysis := NewSensitivityAnalysis(d, 200, 1)
+	for i, x := range d.Points {
+		var y float64
+		for k := range a {
+			y += a[k] * x[k]
+		}
+		for r := range analysis.y[i] {
+			analysis.y[i][r] = y
+		}
+	}
+	return analysis
+}
+
+// TestSobolIndices checks the estimates against the indices of an additive
+// linear model of uniform factors, S_i = T_i = a_i² / Σ a².
+func TestSobolIndices(t *testing.T) {
+	a := [3]float64{1, 2, 3}
+	var sum float64
+	for _, x := range a {
+		sum += x * x
+	}
+	indices := linearAnalysis(t, SobolIndices, 1024, a).SobolIndices()
+	if len(indices) != 3*len(SensitivityResponses) {
+		t.Fatalf("%v indices, want %v", len(indices), 3*len(SensitivityResponses))
+	}
+	for i, x := range indices {
+		want := a[i%3] * a[i%3] / sum
+		if math.Abs(x.First-want) > 0.02 || math.Abs(x.Total-want) > 0.02 {
+			t.Errorf("%v on %v: first-order %.4f, total %.4f, want %.4f", x.Factor, x.Response, x.First, x.Total, want)
+		}
+		if x.FirstLow > x.First || x.FirstHigh < x.First || x.TotalLow > x.Total || x.TotalHigh < x.Total {
+			t.Errorf("%v on %v: intervals [%v, %v] and [%v, %v] leave out the estimates", x.Factor, x.Response, x.FirstLow, x.FirstHigh, x.TotalLow, x.TotalHigh)
+		}
+	}
+}
+
+// TestMorrisEffects checks that every elementary effect of a linear model
+// is its coefficient.
+func TestMorrisEffects(t *testing.T) {
+	a := [3]float64{1, -2, 3}
+	effects := linearAnalysis(t, Morris, 20, a).MorrisEffects()
+	if len(effects) != 3*len(SensitivityResponses) {
+		t.Fatalf("%v effects, want %v", len(effects), 3*len(SensitivityResponses))
+	}
+	for i, x := range effects {
+		want := a[i%3]
+		if math.Abs(x.Mu-want) > 1e-9 || math.Abs(x.MuStar-math.Abs(want)) > 1e-9 || x.Sigma > 1e-9 {
+			t.Errorf("%v on %v: mu %v, mu* %v, sigma %v, want %v, %v and 0", x.Factor, x.Response, x.Mu, x.MuStar, x.Sigma, want, math.Abs(want))
+		}
+	}
+}
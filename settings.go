@@ -0,0 +1,141 @@
+package lanchester
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ParseSettings reads settings from a JSON parameter file, with the given
+// fields overridden. Each override is a pair of a field name, matched
+// case-insensitively like the keys of the file, and a JSON value; for a
+// string field, or a value that is not valid JSON, the value is taken as a
+// string.
+//
+// The settings are checked strictly: unknown fields, values of the wrong
+// type and everything Validate rejects are reported together as a
+// ValidationError, with the line and column of each field in the file.
+func ParseSettings(data []byte, overrides [][2]string) (*Settings, error) {
+	scan := scanSettings(data)
+	if scan.malformed {
+		return nil, ValidationError(scan.problems)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	problems := scan.problems
+	overridden := make(map[string]bool)
+	for _, o := range overrides {
+		name, value := o[0], o[1]
+		f, ok := settingsField(name)
+		if !ok {
+			problems = append(problems, Problem{Field: name, Message: "unknown setting"})
+			continue
+		}
+		raw := []byte(value)
+		if f.Type.Kind() == reflect.String || !json.Valid(raw) {
+			raw, _ = json.Marshal(value)
+		}
+		if err := json.Unmarshal(raw, reflect.New(f.Type).Interface()); err != nil {
+			problems = append(problems, Problem{Field: name, Message: fmt.Sprintf("cannot set to %v: %v", value, err)})
+			continue
+		}
+		// the override replaces the field however the file spells it
+		for k := range fields {
+			if strings.EqualFold(k, name) {
+				delete(fields, k)
+			}
+		}
+		fields[name] = raw
+		// and nothing in the file locates its problems
+		key := strings.ToLower(name)
+		overridden[key] = true
+		for k := range scan.at {
+			if k == key || within(k, key) {
+				delete(scan.at, k)
+			}
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	// a value of the wrong type is left at zero, and the rest are still
+	// checked
+	var set Settings
+	err = json.Unmarshal(data, &set)
+	for k, v := range fields {
+		if strings.EqualFold(k, "seed") && string(v) != "null" {
+			set.seeded = true
+		}
+	}
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && (!ok || len(problems) == 0) {
+		if len(problems) == 0 {
+			return nil, err
+		}
+		return nil, sortProblems(problems)
+	}
+	known := len(problems)
+	for _, p := range set.problems() {
+		if related(p.Field, problems[:known]) {
+			continue
+		}
+		top := p.Field
+		if i := strings.IndexAny(top, ".["); i >= 0 {
+			top = top[:i]
+		}
+		if overridden[strings.ToLower(top)] {
+			p.Message += " (overridden)"
+		}
+		problems = append(problems, scan.locate(p))
+	}
+	if len(problems) > 0 {
+		return nil, sortProblems(problems)
+	}
+	return &set, nil
+}
+
+// Sort problems into file order, followed by those that are not in the file
+func sortProblems(problems []Problem) ValidationError {
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i], problems[j]
+		if (a.Line == 0) != (b.Line == 0) {
+			return b.Line == 0
+		}
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return ValidationError(problems)
+}
+
+// Whether a field is, contains or is part of a field with one of the given
+// problems
+func related(field string, problems []Problem) bool {
+	field = strings.ToLower(field)
+	for _, p := range problems {
+		f := strings.ToLower(p.Field)
+		if f == field || within(field, f) || within(f, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether field a is part of field b
+func within(a, b string) bool {
+	return strings.HasPrefix(a, b+".") || strings.HasPrefix(a, b+"[")
+}
+
+// The field of Settings with the given JSON name, ignoring case
+func settingsField(name string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(Settings{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if strings.EqualFold(strings.Split(f.Tag.Get("json"), ",")[0], name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
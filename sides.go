@@ -0,0 +1,118 @@
+package lanchester
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Side is one of the named forces of a battle between any number of sides.
+// Its deployment is used only when the battle is fought on a grid.
+type Side struct {
+	Name             string          `json:"name"`
+	Units            []UnitType      `json:"units"`
+	RetreatThreshold float64         `json:"retreatThreshold"`
+	Targeting        Targeting       `json:"targeting"`
+	Deployment       Deployment      `json:"deployment"`
+	Reinforcements   []Reinforcement `json:"reinforcements"`
+	Resupply         float64         `json:"resupply"`
+	Morale           Morale          `json:"morale"`
+}
+
+// AllSides returns the sides of the battle: Sides if set, and otherwise the
+// red and blue forces, deployed on the left and right of the grid.
+func (p Parameters) AllSides() []Side {
+	if len(p.Sides) > 0 {
+		sides := make([]Side, len(p.Sides))
+		for i, s := range p.Sides {
+			if s.Name == "" {
+				s.Name = fmt.Sprintf("side%v", i+1)
+			}
+			sides[i] = s
+		}
+		return sides
+	}
+	red, blue := p.Forces()
+	sides := []Side{
+		{Name: "red", Units: red, RetreatThreshold: p.RedRetreatThreshold, Targeting: p.RedTargeting, Reinforcements: p.RedReinforcements, Resupply: p.RedResupply, Morale: p.RedMorale},
+		{Name: "blue", Units: blue, RetreatThreshold: p.BlueRetreatThreshold, Targeting: p.BlueTargeting, Reinforcements: p.BlueReinforcements, Resupply: p.BlueResupply, Morale: p.BlueMorale},
+	}
+	if p.Grid != nil {
+		sides[0].Deployment, sides[1].Deployment = p.Grid.Red, p.Grid.Blue
+		sides[0].Deployment.Edge, sides[1].Deployment.Edge = Left, Right
+	}
+	return sides
+}
+
+// hostility returns the hostility matrix of the sides, in which by default
+// every side is hostile to every other. No side is ever hostile to itself.
+func (p Parameters) hostility() [][]bool {
+	n := len(p.AllSides())
+	h := make([][]bool, n)
+	for i := range h {
+		h[i] = make([]bool, n)
+		for j := range h[i] {
+			if i == j {
+				continue
+			}
+			if i < len(p.Hostility) && j < len(p.Hostility[i]) {
+				h[i][j] = p.Hostility[i][j]
+			} else {
+				h[i][j] = len(p.Hostility) == 0
+			}
+		}
+	}
+	return h
+}
+
+// The forces hostile to f that are still in the fight
+func (b *Battle) enemies(f *force) []*force {
+	var enemies []*force
+	for i := range b.forces {
+		if b.hostile[f.side][i] && !b.forces[i].routed {
+			enemies = append(enemies, &b.forces[i])
+		}
+	}
+	return enemies
+}
+
+// formatHostility encodes a hostility matrix as rows of 0s and 1s
+// separated by semicolons.
+func formatHostility(h [][]bool) string {
+	rows := make([]string, len(h))
+	for i, row := range h {
+		b := make([]byte, len(row))
+		for j, x := range row {
+			b[j] = '0'
+			if x {
+				b[j] = '1'
+			}
+		}
+		rows[i] = string(b)
+	}
+	return strings.Join(rows, ";")
+}
+
+// parseHostility is the inverse of formatHostility.
+func parseHostility(s string) ([][]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	rows := strings.Split(s, ";")
+	h := make([][]bool, len(rows))
+	for i, row := range rows {
+		if len(row) != len(rows) {
+			return nil, fmt.Errorf("malformed hostility matrix %q", s)
+		}
+		h[i] = make([]bool, len(row))
+		for j, c := range row {
+			switch c {
+			case '1':
+				h[i][j] = true
+			case '0':
+			default:
+				return nil, fmt.Errorf("malformed hostility matrix %q", s)
+			}
+		}
+	}
+	return h, nil
+}
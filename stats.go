@@ -0,0 +1,153 @@
+package lanchester
+
+import "math"
+
+// homogeneity performs a chi-squared test of homogeneity on a table of
+// counts, one row per sample, skipping empty columns.
+func homogeneity(counts [][]int) (chi float64, df int, p float64) {
+	rows := make([]float64, len(counts))
+	var total float64
+	for k := range counts {
+		for _, c := range counts[k] {
+			rows[k] += float64(c)
+		}
+		total += rows[k]
+	}
+	if len(counts) == 0 || total == 0 {
+		return 0, 0, 1
+	}
+	cols := 0
+	for n := range counts[0] {
+		var col float64
+		for k := range counts {
+			col += float64(counts[k][n])
+		}
+		if col == 0 {
+			continue
+		}
+		cols++
+		for k := range counts {
+			if rows[k] == 0 {
+				continue
+			}
+			expected := rows[k] * col / total
+			d := float64(counts[k][n]) - expected
+			chi += d * d / expected
+		}
+	}
+	nonEmpty := 0
+	for _, r := range rows {
+		if r > 0 {
+			nonEmpty++
+		}
+	}
+	df = (cols - 1) * (nonEmpty - 1)
+	if df <= 0 {
+		return chi, 0, 1
+	}
+	return chi, df, chiSquareSF(chi, df)
+}
+
+// welch performs Welch's two-sample t-test on the means of a and b, using
+// the normal approximation to the t distribution, which is adequate for
+// the large samples the diagnostics draw. Identical samples give p = 1.
+func welch(a, b []float64) (t, p float64) {
+	ma, va := meanVar(a)
+	mb, vb := meanVar(b)
+	se := math.Sqrt(va/float64(len(a)) + vb/float64(len(b)))
+	if se == 0 {
+		if ma == mb {
+			return 0, 1
+		}
+		return math.Inf(1), 0
+	}
+	t = (ma - mb) / se
+	return t, math.Erfc(math.Abs(t) / math.Sqrt2)
+}
+
+// meanVar returns the mean and unbiased sample variance of x.
+func meanVar(x []float64) (mean, variance float64) {
+	if len(x) == 0 {
+		return 0, 0
+	}
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+	if len(x) < 2 {
+		return mean, 0
+	}
+	for _, v := range x {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, variance / float64(len(x)-1)
+}
+
+// quantile returns the q-quantile of sorted, interpolating linearly
+// between order statistics.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	h := q * float64(len(sorted)-1)
+	i := int(h)
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (h-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// chiSquareSF returns the probability that a chi-squared variable with df
+// degrees of freedom exceeds x.
+func chiSquareSF(x float64, df int) float64 {
+	if x <= 0 {
+		return 1
+	}
+	return gammaQ(float64(df)/2, x/2)
+}
+
+// gammaQ is the regularized upper incomplete gamma function Q(a, x),
+// evaluated by its series for small x and its continued fraction otherwise.
+func gammaQ(a, x float64) float64 {
+	const (
+		maxIter = 1000
+		eps     = 1e-14
+		tiny    = 1e-300
+	)
+	lga, _ := math.Lgamma(a)
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < maxIter; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*eps {
+				break
+			}
+		}
+		return 1 - sum*math.Exp(-x+a*math.Log(x)-lga)
+	}
+	// modified Lentz's method
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < maxIter; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < eps {
+			break
+		}
+	}
+	return math.Exp(-x+a*math.Log(x)-lga) * h
+}
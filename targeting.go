@@ -0,0 +1,196 @@
+package lanchester
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// Targeting selects how a force's units pick targets when they shoot.
+type Targeting int
+
+const (
+	// Fire one shot at each of the first maxShots units of the enemy
+	Sequential Targeting = iota
+	// Fire each shot at an enemy unit chosen uniformly at random
+	UniformRandom
+	// Concentrate fire on the weakest enemy unit
+	FocusFire
+	// Distribute shots evenly over the enemy, starting from a random unit
+	Spread
+	// Fire at the most dangerous enemy units first
+	HighestThreat
+)
+
+func (t Targeting) String() string {
+	switch t {
+	case Sequential:
+		return "sequential"
+	case UniformRandom:
+		return "random"
+	case FocusFire:
+		return "focus-fire"
+	case Spread:
+		return "spread"
+	case HighestThreat:
+		return "highest-threat"
+	}
+	return "undefined"
+}
+
+// ParseTargeting is the inverse of Targeting.String.
+func ParseTargeting(s string) (Targeting, error) {
+	for t := Sequential; t <= HighestThreat; t++ {
+		if t.String() == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown targeting policy %q", s)
+}
+
+// MarshalText lets targeting policies be written by name in JSON.
+func (t Targeting) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText reads a targeting policy by name.
+func (t *Targeting) UnmarshalText(text []byte) error {
+	x, err := ParseTargeting(string(text))
+	if err != nil {
+		return err
+	}
+	*t = x
+	return nil
+}
+
+// A targeter aims the shots of one volley. aim returns the index in
+// target.forces of the unit to fire the given shot at, or -1 to stop
+// firing. Units with no health left are dead, even if they have not been
+// removed yet. Shots are resolved as they are aimed, so a targeter sees the
+// damage done by the earlier shots of the volley. In continuous time a
+// volley is fired one shot at a time, and the enemy may have lost or
+// gained units between shots.
+type targeter interface {
+	aim(rng *rand.Rand, target *force, shot int) int
+}
+
+func newTargeter(t Targeting) targeter {
+	switch t {
+	case UniformRandom:
+		return randomTargeter{}
+	case FocusFire:
+		return focusTargeter{}
+	case Spread:
+		return &spreadTargeter{}
+	case HighestThreat:
+		return &threatTargeter{}
+	}
+	return sequentialTargeter{}
+}
+
+// sequentialTargeter fires at the enemy in order, one shot each, whether or
+// not the unit has already been killed this turn.
+type sequentialTargeter struct{}
+
+func (sequentialTargeter) aim(rng *rand.Rand, target *force, shot int) int {
+	if shot < target.size() {
+		return target.index(shot)
+	}
+	return -1
+}
+
+// randomTargeter picks a living enemy uniformly for every shot.
+type randomTargeter struct{}
+
+func (randomTargeter) aim(rng *rand.Rand, target *force, shot int) int {
+	n := 0
+	for _, u := range target.forces {
+		if u.health > 0 {
+			n++
+		}
+	}
+	if n == 0 {
+		return -1
+	}
+	k := rng.Intn(n)
+	for i, u := range target.forces {
+		if u.health > 0 {
+			if k == 0 {
+				return i
+			}
+			k--
+		}
+	}
+	return -1
+}
+
+// focusTargeter fires every shot at the living enemy with the least
+// health, moving on only once it is killed.
+type focusTargeter struct{}
+
+func (focusTargeter) aim(rng *rand.Rand, target *force, shot int) int {
+	best := -1
+	for i, u := range target.forces {
+		if u.health > 0 && (best < 0 || u.health < target.forces[best].health) {
+			best = i
+		}
+	}
+	return best
+}
+
+// spreadTargeter walks the enemy line from a random starting unit, one shot
+// per living unit, wrapping around if it has more shots than targets.
+type spreadTargeter struct {
+	next int
+}
+
+func (t *spreadTargeter) aim(rng *rand.Rand, target *force, shot int) int {
+	n := target.size()
+	if n == 0 {
+		return -1
+	}
+	if shot == 0 {
+		t.next = rng.Intn(n)
+	}
+	for k := 0; k < n; k++ {
+		i := (t.next + k) % n
+		if target.living(i).health > 0 {
+			t.next = i + 1
+			return target.index(i)
+		}
+	}
+	return -1
+}
+
+// threatTargeter fires at the living enemies with the highest expected
+// kills per activation (shot probability times max shots), one shot each,
+// wrapping around if it has more shots than targets.
+type threatTargeter struct {
+	order []int
+	next  int
+}
+
+func (t *threatTargeter) aim(rng *rand.Rand, target *force, shot int) int {
+	if shot == 0 || len(t.order) != len(target.forces) {
+		t.order = t.order[:0]
+		for i := range target.forces {
+			t.order = append(t.order, i)
+		}
+		sort.SliceStable(t.order, func(a, b int) bool {
+			return threat(target.forces[t.order[a]]) > threat(target.forces[t.order[b]])
+		})
+		t.next = 0
+	}
+	for k := 0; k < len(t.order); k++ {
+		i := t.order[(t.next+k)%len(t.order)]
+		if target.forces[i].health > 0 {
+			t.next += k + 1
+			return i
+		}
+	}
+	return -1
+}
+
+func threat(u unit) float64 {
+	return u.shotProb * float64(u.maxShots)
+}
@@ -0,0 +1,254 @@
+package lanchester
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Terrain gives every cell of the grid a cover, a movement cost and
+// whether it blocks line of sight. Cells are stored row by row.
+//
+// Cover, between 0 (open ground) and 1, scales down the kill probability of
+// shots at a unit in the cell by (1 - cover). Entering a cell uses up its
+// movement cost out of a unit's speed for the turn; open ground costs 1. No
+// unit can see or fire through a cell that blocks line of sight, although
+// units in such a cell can see and be seen.
+type Terrain struct {
+	Width  int
+	Height int
+	Cover  []float64
+	Cost   []float64
+	Blocks []bool
+}
+
+// LoadTerrain reads a terrain map from a PGM image (.pgm) or a CSV grid
+// (any other extension).
+//
+// In a PGM image, plain (P2) or raw (P5), each pixel is a cell of density
+// d = value/maxval: its cover is d, its movement cost is 1 + d, and pixels
+// at maxval block line of sight.
+//
+// In a CSV grid, each record is a row of cells and each field is
+// cover[:cost[:block]], with a cost of 1 and no blocking by default; block
+// is 1 or 0.
+func LoadTerrain(path string) (*Terrain, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".pgm") {
+		return readPGM(bytes.NewReader(data))
+	}
+	return readTerrainCSV(bytes.NewReader(data))
+}
+
+func newTerrain(w, h int) *Terrain {
+	t := &Terrain{Width: w, Height: h,
+		Cover:  make([]float64, w*h),
+		Cost:   make([]float64, w*h),
+		Blocks: make([]bool, w*h)}
+	for i := range t.Cost {
+		t.Cost[i] = 1
+	}
+	return t
+}
+
+func readPGM(r io.Reader) (*Terrain, error) {
+	br := bufio.NewReader(r)
+	// the header is whitespace-separated, with # comments
+	token := func() (string, error) {
+		var b []byte
+		for {
+			c, err := br.ReadByte()
+			if err != nil {
+				if err == io.EOF && len(b) > 0 {
+					return string(b), nil
+				}
+				return "", err
+			}
+			switch {
+			case c == '#' && len(b) == 0:
+				if _, err := br.ReadString('\n'); err != nil {
+					return "", err
+				}
+			case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+				if len(b) > 0 {
+					return string(b), nil
+				}
+			default:
+				b = append(b, c)
+			}
+		}
+	}
+	number := func() (int, error) {
+		s, err := token()
+		if err != nil {
+			return 0, fmt.Errorf("truncated PGM file: %v", err)
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("malformed PGM file: unexpected %q", s)
+		}
+		return n, nil
+	}
+
+	magic, err := token()
+	if err != nil {
+		return nil, fmt.Errorf("truncated PGM file: %v", err)
+	}
+	if magic != "P2" && magic != "P5" {
+		return nil, fmt.Errorf("not a PGM file: magic number %q", magic)
+	}
+	var dims [3]int
+	for i := range dims {
+		if dims[i], err = number(); err != nil {
+			return nil, err
+		}
+	}
+	w, h, maxval := dims[0], dims[1], dims[2]
+	if w == 0 || h == 0 || maxval == 0 || maxval > 65535 {
+		return nil, fmt.Errorf("malformed PGM file: %vx%v with maxval %v", w, h, maxval)
+	}
+
+	t := newTerrain(w, h)
+	for i := 0; i < w*h; i++ {
+		var v int
+		if magic == "P2" {
+			if v, err = number(); err != nil {
+				return nil, err
+			}
+		} else {
+			// raw samples are one byte, or two big-endian bytes
+			n := 1
+			if maxval > 255 {
+				n = 2
+			}
+			for k := 0; k < n; k++ {
+				c, err := br.ReadByte()
+				if err != nil {
+					return nil, errors.New("truncated PGM file")
+				}
+				v = v<<8 | int(c)
+			}
+		}
+		if v > maxval {
+			return nil, fmt.Errorf("malformed PGM file: value %v exceeds maxval %v", v, maxval)
+		}
+		d := float64(v) / float64(maxval)
+		t.Cover[i], t.Cost[i], t.Blocks[i] = d, 1+d, v == maxval
+	}
+	return t, nil
+}
+
+func readTerrainCSV(r io.Reader) (*Terrain, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, errors.New("empty terrain file")
+	}
+	t := newTerrain(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, cell := range row {
+			i := y*t.Width + x
+			f := strings.Split(cell, ":")
+			if len(f) > 3 {
+				return nil, fmt.Errorf("row %v, column %v: malformed cell %q", y+1, x+1, cell)
+			}
+			var err [3]error
+			t.Cover[i], err[0] = strconv.ParseFloat(f[0], 64)
+			if len(f) > 1 {
+				t.Cost[i], err[1] = strconv.ParseFloat(f[1], 64)
+			}
+			if len(f) > 2 {
+				t.Blocks[i], err[2] = strconv.ParseBool(f[2])
+			}
+			for _, e := range err {
+				if e != nil {
+					return nil, fmt.Errorf("row %v, column %v: %v", y+1, x+1, e)
+				}
+			}
+			if t.Cover[i] < 0 || t.Cover[i] > 1 || t.Cost[i] <= 0 {
+				return nil, fmt.Errorf("row %v, column %v: cover must be in [0, 1] and cost positive", y+1, x+1)
+			}
+		}
+	}
+	return t, nil
+}
+
+// LoadTerrain reads the grid's terrain file, if it names one. A grid of
+// unspecified size takes its size from the map; otherwise the sizes must
+// agree.
+func (g *Grid) LoadTerrain() error {
+	if g.TerrainFile == "" {
+		return nil
+	}
+	t, err := LoadTerrain(g.TerrainFile)
+	if err != nil {
+		return fmt.Errorf("terrain %v: %v", g.TerrainFile, err)
+	}
+	if g.Width == 0 && g.Height == 0 {
+		g.Width, g.Height = t.Width, t.Height
+	} else if g.Width != t.Width || g.Height != t.Height {
+		return fmt.Errorf("terrain %v is %vx%v but the grid is %vx%v", g.TerrainFile, t.Width, t.Height, g.Width, g.Height)
+	}
+	g.Terrain = t
+	return nil
+}
+
+// The cover of the cell of unit u
+func (t *Terrain) cover(u unit) float64 {
+	if t == nil {
+		return 0
+	}
+	return t.Cover[u.y*t.Width+u.x]
+}
+
+// The movement cost of the cell at x, y
+func (t *Terrain) cost(x, y int) float64 {
+	if t == nil {
+		return 1
+	}
+	return t.Cost[y*t.Width+x]
+}
+
+// Whether a and b can see each other: no cell strictly between them on the
+// line joining them blocks line of sight.
+func (t *Terrain) visible(a, b unit) bool {
+	if t == nil {
+		return true
+	}
+	// Bresenham's line algorithm
+	dx, dy := sign(b.x-a.x)*(b.x-a.x), -sign(b.y-a.y)*(b.y-a.y)
+	sx, sy := sign(b.x-a.x), sign(b.y-a.y)
+	e := dx + dy
+	x, y := a.x, a.y
+	for {
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y += sy
+		}
+		if x == b.x && y == b.y {
+			return true
+		}
+		if t.Blocks[y*t.Width+x] {
+			return false
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package lanchester
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Problem is one thing wrong with a parameter file: the field it concerns,
+// where the field is in the file (Line is 0 if it is not there, e.g. if it
+// was left out or set on the command line) and what is wrong with it.
+type Problem struct {
+	Field   string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	s := p.Message
+	if p.Field != "" {
+		s = p.Field + ": " + s
+	}
+	if p.Line > 0 {
+		s = fmt.Sprintf("line %v, column %v: %v", p.Line, p.Column, s)
+	}
+	return s
+}
+
+// ValidationError lists every problem found in a parameter file.
+type ValidationError []Problem
+
+func (e ValidationError) Error() string {
+	s := make([]string, len(e))
+	for i, p := range e {
+		s[i] = p.String()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Validate checks the settings for values that would make a batch fail,
+// panic or never finish, and reports every problem it finds as a
+// ValidationError.
+func (set *Settings) Validate() error {
+	if problems := set.problems(); len(problems) > 0 {
+		return ValidationError(problems)
+	}
+	return nil
+}
+
+func (set *Settings) problems() []Problem {
+	var ps []Problem
+	add := func(field, format string, args ...interface{}) {
+		ps = append(ps, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	prob := func(field string, x float64) {
+		if x < 0 || x > 1 {
+			add(field, "%v is not between 0 and 1", x)
+		}
+	}
+	atLeast := func(field string, x float64, min float64) {
+		if x < min {
+			add(field, "%v is less than %v", x, min)
+		}
+	}
+
+	if set.BatchMode < SingleRun || set.BatchMode > Morris {
+		add("batchMode", "unknown batch mode %v", set.BatchMode)
+	}
+	if set.BatchMode != SingleRun && set.BatchMode != Exact && set.Niter <= 0 {
+		add("niter", "a batch needs at least one run, not %v", set.Niter)
+	}
+	atLeast("workers", float64(set.Workers), 0)
+	if set.BatchMode == FractionalFactorial || set.BatchMode == PlackettBurman {
+		if _, err := set.Screening(); err != nil {
+			add("batchMode", "%v", err)
+		}
+	}
+	if n := len(set.sampled()); set.BatchMode == SobolSequence && n > MaxSobolDims {
+		add("batchMode", "%v fields vary, but the Sobol sampler supports at most %v", n, MaxSobolDims)
+	}
+	if set.BatchMode == SobolIndices || set.BatchMode == Morris {
+		if _, err := set.Sensitivity(); err != nil {
+			add("batchMode", "%v", err)
+		}
+	}
+	if set.Aggregate && set.WriteDynamics {
+		add("aggregate", "aggregated output has one row per design point, not per turn; turn off writeDynamics")
+	}
+	atLeast("replicates", float64(set.Replicates), 0)
+	atLeast("bootstrap", float64(set.Bootstrap), 0)
+	if set.MorrisLevels != 0 && set.MorrisLevels < 2 {
+		add("morrisLevels", "a Morris grid needs at least 2 levels, not %v", set.MorrisLevels)
+	}
+	if set.Resolution != 0 && set.Resolution < 3 {
+		add("resolution", "resolution %v is below III, at which main effects are aliased with each other", set.Resolution)
+	}
+	if len(set.ActivationOrder) == 0 {
+		add("activationOrder", "no activation order given")
+	}
+	for i, a := range set.ActivationOrder {
+		if a < RandomSynchronous || a > ContinuousTime {
+			add(fmt.Sprintf("activationOrder[%v]", i), "unknown activation order %v", int(a))
+		}
+	}
+
+	// ranged fields: [min, max, step]. Those that unit types or sides
+	// override are still drawn from by the random batch modes, so their
+	// ranges must be well formed, but their values need not be sensible.
+	ranged := func(field string, r [3]float64, min, max float64) {
+		if r[0] > r[1] {
+			add(field, "min %v exceeds max %v", r[0], r[1])
+		}
+		if r[2] < 0 {
+			add(field, "step %v is negative", r[2])
+		}
+		if set.overridden(field) {
+			return
+		}
+		if _, ok := set.sweepLevels(field); r[2] == 0 && r[0] != r[1] && set.BatchMode == ParameterSweep && !ok {
+			add(field, "a sweep from %v to %v needs a positive step", r[0], r[1])
+		}
+		for _, x := range r[:2] {
+			if x < min || x > max {
+				if max == 1 {
+					add(field, "%v is not between %v and %v", x, min, max)
+				} else {
+					add(field, "%v is less than %v", x, min)
+				}
+				break
+			}
+		}
+	}
+	ints := func(r [3]int) [3]float64 {
+		return [3]float64{float64(r[0]), float64(r[1]), float64(r[2])}
+	}
+	inf := 1e308
+	ranged("RedSize", ints(set.RedSize), 0, inf)
+	ranged("RedHealth", ints(set.RedHealth), 1, inf)
+	ranged("RedShotProb", set.RedShotProb, 0, 1)
+	ranged("RedMaxShots", ints(set.RedMaxShots), 0, inf)
+	ranged("BlueSize", ints(set.BlueSize), 0, inf)
+	ranged("BlueHealth", ints(set.BlueHealth), 1, inf)
+	ranged("BlueShotProb", set.BlueShotProb, 0, 1)
+	ranged("BlueMaxShots", ints(set.BlueMaxShots), 0, inf)
+	ranged("RedRetreatThreshold", set.RedRetreatThreshold, 0, 1)
+	ranged("BlueRetreatThreshold", set.BlueRetreatThreshold, 0, 1)
+
+	// unit types and sides are named in the output, in columns of their own
+	// and in lists separated by these characters
+	units := func(field string, types []UnitType) {
+		names := make(map[string]bool)
+		for i, t := range types {
+			f := fmt.Sprintf("%v[%v].", field, i)
+			if strings.ContainsAny(t.Name, ":;") {
+				add(f+"name", "%q contains a colon or semicolon, which separate unit types in the output", t.Name)
+			}
+			if name := typeName(t, i); names[name] {
+				add(f+"name", "another unit type is called %q", name)
+			} else {
+				names[name] = true
+			}
+			atLeast(f+"count", float64(t.Count), 0)
+			atLeast(f+"health", float64(t.Health), 1)
+			prob(f+"shotProb", t.ShotProb)
+			atLeast(f+"maxShots", float64(t.MaxShots), 0)
+			atLeast(f+"ammo", float64(t.Ammo), 0)
+		}
+	}
+	reinforcements := func(field string, rs []Reinforcement, types []UnitType) {
+		for i, r := range rs {
+			f := fmt.Sprintf("%v[%v].", field, i)
+			atLeast(f+"count", float64(r.Count), 0)
+			atLeast(f+"turn", float64(r.Turn), 0)
+			atLeast(f+"rate", r.Rate, 0)
+			atLeast(f+"below", float64(r.Below), 0)
+			known := r.Type == ""
+			for _, t := range types {
+				known = known || t.Name == r.Type
+			}
+			if !known {
+				add(f+"type", "the force has no unit type %q", r.Type)
+			}
+		}
+	}
+	morale := func(field string, m Morale) {
+		prob(field+".suppression", m.Suppression)
+		prob(field+".recovery", m.Recovery)
+		prob(field+".break", m.Break)
+		prob(field+".rout", m.Rout)
+	}
+	deployment := func(field string, d Deployment) {
+		atLeast(field+".depth", float64(d.Depth), 0)
+		atLeast(field+".speed", float64(d.Speed), 0)
+		if d.Movement == Advance && d.Speed == 0 {
+			add(field+".speed", "an advancing force needs a positive speed; use hold to stay put")
+		}
+		atLeast(field+".range", d.Range, 0)
+		prob(field+".falloff", d.Falloff)
+	}
+
+	if len(set.Sides) == 0 {
+		units("redUnits", set.RedUnits)
+		units("blueUnits", set.BlueUnits)
+		red, blue := set.withForces(Parameters{}).Forces()
+		reinforcements("redReinforcements", set.RedReinforcements, red)
+		reinforcements("blueReinforcements", set.BlueReinforcements, blue)
+		atLeast("redAmmo", float64(set.RedAmmo), 0)
+		atLeast("blueAmmo", float64(set.BlueAmmo), 0)
+		atLeast("redResupply", set.RedResupply, 0)
+		atLeast("blueResupply", set.BlueResupply, 0)
+		morale("redMorale", set.RedMorale)
+		morale("blueMorale", set.BlueMorale)
+		if len(set.Hostility) > 0 && len(set.Hostility) != 2 {
+			add("hostility", "%v rows for 2 forces", len(set.Hostility))
+		}
+	} else {
+		names := make(map[string]bool)
+		for i, side := range set.withForces(Parameters{}).AllSides() {
+			f := fmt.Sprintf("sides[%v]", i)
+			if strings.ContainsAny(side.Name, ";+") {
+				add(f+".name", "%q contains a semicolon or plus sign, which separate sides in the output", side.Name)
+			}
+			if names[side.Name] {
+				add(f+".name", "another side is called %q", side.Name)
+			}
+			names[side.Name] = true
+			if len(side.Units) == 0 {
+				add(f+".units", "a side needs at least one unit type")
+			}
+			units(f+".units", side.Units)
+			prob(f+".retreatThreshold", side.RetreatThreshold)
+			reinforcements(f+".reinforcements", side.Reinforcements, side.Units)
+			atLeast(f+".resupply", side.Resupply, 0)
+			morale(f+".morale", side.Morale)
+			if set.Grid != nil {
+				deployment(f+".deployment", side.Deployment)
+			}
+		}
+		if len(set.Hostility) > 0 && len(set.Hostility) != len(set.Sides) {
+			add("hostility", "%v rows for %v sides", len(set.Hostility), len(set.Sides))
+		}
+		if len(set.AnalyticLaws) > 0 {
+			add("analyticLaws", "analytic laws cover red and blue only, not named sides")
+		}
+	}
+	for i, row := range set.Hostility {
+		if len(row) != len(set.Hostility) {
+			add(fmt.Sprintf("hostility[%v]", i), "%v columns for %v rows", len(row), len(set.Hostility))
+		}
+		if i < len(row) && row[i] {
+			add(fmt.Sprintf("hostility[%v][%v]", i, i), "a side cannot be hostile to itself")
+		}
+	}
+
+	if g := set.Grid; g != nil {
+		if g.TerrainFile == "" || g.Width != 0 || g.Height != 0 {
+			atLeast("grid.width", float64(g.Width), 1)
+			atLeast("grid.height", float64(g.Height), 1)
+		}
+		if len(set.Sides) == 0 {
+			deployment("grid.red", g.Red)
+			deployment("grid.blue", g.Blue)
+		}
+	}
+	atLeast("stallTurns", float64(set.StallTurns), 0)
+	if set.BatchMode == Exact {
+		if set.MaxTurns >= 0 {
+			add("maxTurns", "the exact solution covers battles without a turn limit; set maxTurns to -1")
+		}
+		if set.StallTurns > 0 {
+			add("stallTurns", "the exact solution covers battles without a turn limit")
+		}
+	}
+	if set.LHSCriterion != "" && set.LHSCriterion != "maximin" && set.LHSCriterion != "correlation" {
+		add("lhsCriterion", "unknown criterion %q; use maximin or correlation", set.LHSCriterion)
+	}
+	atLeast("lhsCandidates", float64(set.LHSCandidates), 0)
+	var levels []string
+	for name := range set.SweepLevels {
+		levels = append(levels, name)
+	}
+	sort.Strings(levels)
+	for _, name := range levels {
+		f, ok := jsonField(reflect.TypeOf(Settings{}), name)
+		if !ok || f.Type != reflect.TypeOf([3]float64{}) {
+			add("sweepLevels."+name, "not a ranged real-valued field")
+		} else if n := set.SweepLevels[name]; n < 1 {
+			add("sweepLevels."+name, "%v levels; there must be at least one", n)
+		}
+	}
+	return ps
+}
+
+// A settingsScanner walks a parameter file token by token alongside the
+// Settings type, noting where every field is and any that are unknown or of
+// the wrong type.
+type settingsScanner struct {
+	data     []byte
+	dec      *json.Decoder
+	at       map[string]int // offset of each field, by lower-case path
+	names    map[string]string
+	problems []Problem
+	// whether the file is not JSON at all
+	malformed bool
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// scanSettings checks a parameter file against the Settings type. The
+// scanner it returns holds the problems found and the positions of the
+// fields, which locate any problems found later.
+func scanSettings(data []byte) *settingsScanner {
+	s := &settingsScanner{
+		data:  data,
+		dec:   json.NewDecoder(bytes.NewReader(data)),
+		at:    make(map[string]int),
+		names: make(map[string]string),
+	}
+	s.dec.UseNumber()
+	if err := s.value(reflect.TypeOf(Settings{}), ""); err != nil {
+		s.syntax(err)
+		return s
+	}
+	if _, err := s.dec.Token(); err != io.EOF {
+		s.problems = append(s.problems, s.problem("", s.start(), "unexpected data after the settings"))
+		s.malformed = true
+	}
+	return s
+}
+
+// The offset of the next token
+func (s *settingsScanner) start() int {
+	i := int(s.dec.InputOffset())
+	for i < len(s.data) && strings.IndexByte(" \t\r\n,:", s.data[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+func (s *settingsScanner) problem(path string, offset int, format string, args ...interface{}) Problem {
+	line, col := position(s.data, offset)
+	return Problem{Field: path, Line: line, Column: col, Message: fmt.Sprintf(format, args...)}
+}
+
+// Record a syntax error, which ends the scan
+func (s *settingsScanner) syntax(err error) {
+	offset := s.start()
+	if e, ok := err.(*json.SyntaxError); ok {
+		offset = int(e.Offset)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("unexpected end of file")
+	}
+	s.problems = append(s.problems, s.problem("", offset, "%v", err))
+	s.malformed = true
+}
+
+// Scan one value of type t at the given path, returning only syntax errors
+func (s *settingsScanner) value(t reflect.Type, path string) error {
+	offset := s.start()
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	wrong := func(want string) error {
+		s.problems = append(s.problems, s.problem(path, offset, "expected %v", want))
+		if d, ok := tok.(json.Delim); ok && (d == '{' || d == '[') {
+			return s.skip()
+		}
+		return nil
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshaler) {
+		str, ok := tok.(string)
+		if !ok {
+			return wrong("a name")
+		}
+		if err := reflect.New(t).Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str)); err != nil {
+			s.problems = append(s.problems, s.problem(path, offset, "%v", err))
+		}
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if tok != json.Delim('{') {
+			return wrong("an object")
+		}
+		for s.dec.More() {
+			offset := s.start()
+			key, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			name := key.(string)
+			f, ok := jsonField(t, name)
+			child := name
+			if path != "" {
+				child = path + "." + name
+			}
+			if !ok {
+				s.problems = append(s.problems, s.problem(child, offset, "unknown field"))
+				if err := s.skipValue(); err != nil {
+					return err
+				}
+				continue
+			}
+			s.note(child, offset)
+			if err := s.value(f.Type, child); err != nil {
+				return err
+			}
+		}
+		_, err := s.dec.Token()
+		return err
+	case reflect.Map:
+		if tok != json.Delim('{') {
+			return wrong("an object")
+		}
+		for s.dec.More() {
+			offset := s.start()
+			key, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			child := path + "." + key.(string)
+			s.note(child, offset)
+			if err := s.value(t.Elem(), child); err != nil {
+				return err
+			}
+		}
+		_, err := s.dec.Token()
+		return err
+	case reflect.Slice, reflect.Array:
+		if tok != json.Delim('[') {
+			return wrong("an array")
+		}
+		n := 0
+		for ; s.dec.More(); n++ {
+			child := fmt.Sprintf("%v[%v]", path, n)
+			s.note(child, s.start())
+			if err := s.value(t.Elem(), child); err != nil {
+				return err
+			}
+		}
+		if _, err := s.dec.Token(); err != nil {
+			return err
+		}
+		if t.Kind() == reflect.Array && n != t.Len() {
+			if t.Len() == 3 {
+				s.problems = append(s.problems, s.problem(path, offset, "expected [min, max, step], not %v values", n))
+			} else {
+				s.problems = append(s.problems, s.problem(path, offset, "expected %v values, not %v", t.Len(), n))
+			}
+		}
+		return nil
+	case reflect.Bool:
+		if _, ok := tok.(bool); !ok {
+			return wrong("true or false")
+		}
+	case reflect.String:
+		if _, ok := tok.(string); !ok {
+			return wrong("a string")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := tok.(json.Number)
+		if !ok {
+			return wrong("an integer")
+		}
+		if _, err := n.Int64(); err != nil {
+			return wrong("an integer")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := tok.(json.Number); !ok {
+			return wrong("a number")
+		}
+	}
+	return nil
+}
+
+// Skip the rest of an object or array whose opening delimiter has been read
+func (s *settingsScanner) skip() error {
+	for depth := 1; depth > 0; {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// Skip a whole value
+func (s *settingsScanner) skipValue() error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == json.Delim('{') || tok == json.Delim('[') {
+		return s.skip()
+	}
+	return nil
+}
+
+// Note where the field at path is, and how the file spells it
+func (s *settingsScanner) note(path string, offset int) {
+	key := strings.ToLower(path)
+	s.at[key], s.names[key] = offset, path
+}
+
+// Place a problem found in the parsed settings at its field in the file
+func (s *settingsScanner) locate(p Problem) Problem {
+	key := strings.ToLower(p.Field)
+	// an element of a field, or a field of an element, that is not in the
+	// file is placed at the nearest enclosing field that is
+	for k := key; k != ""; {
+		if offset, ok := s.at[k]; ok {
+			p.Line, p.Column = position(s.data, offset)
+			if k == key {
+				p.Field = s.names[k]
+			}
+			return p
+		}
+		i := strings.LastIndexAny(k, ".[")
+		if i < 0 {
+			break
+		}
+		k = k[:i]
+	}
+	return p
+}
+
+// The field of struct type t with the given JSON name, ignoring case as
+// encoding/json does
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" || f.PkgPath != "" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Line and column, counting from 1, of an offset into data
+func position(data []byte, offset int) (line, col int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line = 1 + bytes.Count(data[:offset], []byte("\n"))
+	col = offset - bytes.LastIndexByte(data[:offset], '\n')
+	return line, col
+}
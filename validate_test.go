@@ -0,0 +1,156 @@
+package lanchester
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validSettings is a parameter file with no problems, whose fields the
+// tests replace one at a time.
+const validSettings = `{
+	"batchMode": 2,
+	"niter": 10,
+	"activationOrder": [0, 2],
+	"RedSize": [10, 20, 0],
+	"RedHealth": [1, 1, 0],
+	"RedShotProb": [0.1, 0.2, 0],
+	"RedMaxShots": [1, 2, 0],
+	"BlueSize": [10, 20, 0],
+	"BlueHealth": [1, 1, 0],
+	"BlueShotProb": [0.1, 0.2, 0],
+	"BlueMaxShots": [1, 2, 0]
+}`
+
+// parse parses validSettings with the field on the given line replaced
+// by field, and returns the problems found.
+func parse(t *testing.T, line int, field string) ValidationError {
+	t.Helper()
+	lines := strings.Split(validSettings, "\n")
+	if field != "" {
+		lines[line-1] = field
+	}
+	_, err := ParseSettings([]byte(strings.Join(lines, "\n")), nil)
+	if err == nil {
+		return nil
+	}
+	problems, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("%q: got error %v, want a ValidationError", field, err)
+	}
+	return problems
+}
+
+func TestParseSettings(t *testing.T) {
+	if problems := parse(t, 0, ""); problems != nil {
+		t.Fatalf("valid settings rejected: %v", problems)
+	}
+	for _, c := range []struct {
+		line  int
+		field string
+		want  Problem
+	}{
+		{2, `	"batchMod": 2,`, Problem{"batchMod", 2, 2, "unknown field"}},
+		{3, `	"niter": "ten",`, Problem{"niter", 3, 11, "expected an integer"}},
+		{3, `	"niter": 1.5,`, Problem{"niter", 3, 11, "expected an integer"}},
+		{3, `	"niter": 0,`, Problem{"niter", 3, 2, "a batch needs at least one run, not 0"}},
+		{4, `	"activationOrder": [0, 7],`, Problem{"activationOrder[1]", 4, 25, "unknown activation order 7"}},
+		{5, `	"RedSize": [10, 20],`, Problem{"RedSize", 5, 13, "expected [min, max, step], not 2 values"}},
+		{5, `	"RedSize": [20, 10, 0],`, Problem{"RedSize", 5, 2, "min 20 exceeds max 10"}},
+		{5, `	"RedSize": [10, 20, -1],`, Problem{"RedSize", 5, 2, "step -1 is negative"}},
+		{6, `	"RedHealth": [0, 1, 0],`, Problem{"RedHealth", 6, 2, "0 is less than 1"}},
+		{7, `	"RedShotProb": [0.1, 1.2, 0],`, Problem{"RedShotProb", 7, 2, "1.2 is not between 0 and 1"}},
+		// the JSON names of fields match in any case, as encoding/json does
+		{11, `	"blueshotprob": [0.2, 0.1, 0],`, Problem{"blueshotprob", 11, 2, "min 0.2 exceeds max 0.1"}},
+	} {
+		problems := parse(t, c.line, c.field)
+		if len(problems) != 1 || problems[0] != c.want {
+			t.Errorf("%q: got problems %#v, want %#v", c.field, problems, c.want)
+		}
+	}
+
+	// a syntax error is reported where it is, and ends the scan
+	problems := parse(t, 5, `	"RedSize": [10, 20, 0]`)
+	if len(problems) != 1 || problems[0].Line != 6 {
+		t.Errorf("missing comma: got problems %v, want one on line 6", problems)
+	}
+}
+
+// TestValidateOverridden checks that the ranges of fields that unit types
+// or sides override must still be well formed, since the random batch modes
+// draw from them, but that their values are not checked.
+func TestValidateOverridden(t *testing.T) {
+	set := &Settings{
+		BatchMode:       MonteCarlo,
+		Niter:           10,
+		ActivationOrder: []ActivationOrder{RandomSynchronous},
+		RedUnits:        []UnitType{{Name: "rifle", Count: 10, Health: 1, ShotProb: 0.1, MaxShots: 1}},
+		BlueSize:        [3]int{10, 10, 0},
+		BlueHealth:      [3]int{1, 1, 0},
+		BlueShotProb:    [3]float64{0.1, 0.1, 0},
+		BlueMaxShots:    [3]int{1, 1, 0},
+	}
+	if err := set.Validate(); err != nil {
+		t.Fatalf("red fields left at zero rejected: %v", err)
+	}
+
+	set.RedSize = [3]int{20, 10, 0}
+	set.RedShotProb = [3]float64{0.1, 0.2, -0.1}
+	want := ValidationError{
+		{Field: "RedSize", Message: "min 20 exceeds max 10"},
+		{Field: "RedShotProb", Message: "step -0.1 is negative"},
+	}
+	if err := set.Validate(); !reflect.DeepEqual(err, want) {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	set.Sides = []Side{
+		{Name: "a", Units: []UnitType{{Count: 5, Health: 1, ShotProb: 0.1, MaxShots: 1}}},
+		{Name: "b", Units: []UnitType{{Count: 5, Health: 1, ShotProb: 0.1, MaxShots: 1}}},
+	}
+	set.RedSize, set.RedShotProb = [3]int{}, [3]float64{}
+	set.BlueRetreatThreshold = [3]float64{0.5, 0.2, 0}
+	want = ValidationError{{Field: "BlueRetreatThreshold", Message: "min 0.5 exceeds max 0.2"}}
+	if err := set.Validate(); !reflect.DeepEqual(err, want) {
+		t.Errorf("with sides, got %v, want %v", err, want)
+	}
+
+	// and a Monte Carlo batch leaves the overridden fields alone
+	set.Sides = nil
+	set.BlueRetreatThreshold = [3]float64{}
+	set.RedHealth = [3]int{1, 3, 0}
+	set.RedShotProb = [3]float64{0.1, 0.2, 0}
+	n := 0
+	err := set.Each(rand.New(rand.NewSource(1)), func(p Parameters) {
+		n++
+		if p.RedHealth != 1 || p.RedShotProb != 0.1 {
+			t.Errorf("red health %v and shot probability %v drawn", p.RedHealth, p.RedShotProb)
+		}
+	})
+	if err != nil || n != set.Niter {
+		t.Errorf("%v runs, error %v", n, err)
+	}
+}
+
+func TestValidateHostility(t *testing.T) {
+	set := &Settings{
+		ActivationOrder: []ActivationOrder{RandomSynchronous},
+		Sides: []Side{
+			{Name: "a", Units: []UnitType{{Count: 5, Health: 1, ShotProb: 0.5, MaxShots: 1}}},
+			{Name: "b", Units: []UnitType{{Count: 5, Health: 1, ShotProb: 0.5, MaxShots: 1}}},
+		},
+		Hostility: [][]bool{{true, true}, {true, false}},
+	}
+	want := ValidationError{{Field: "hostility[0][0]", Message: "a side cannot be hostile to itself"}}
+	if err := set.Validate(); !reflect.DeepEqual(err, want) {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	// a battle built without validation still leaves the side alone
+	set.Hostility = [][]bool{{true, false}, {false, false}}
+	res := NewBattle(set.Base(), rand.New(rand.NewSource(1))).Run()
+	if res.Outcome != Victory || res.Forces[0] != 5 {
+		t.Errorf("a side hostile only to itself: %v with %v left", res.Outcome, res.Forces)
+	}
+}